@@ -2,56 +2,160 @@ package ezdeploy
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
-	"github.com/karrick/godirwalk"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/karrick/godirwalk"
 )
 
+const (
+	// ChecksumPrefixSHA256 prefix of current checksums, legacy MD5 checksums have no prefix
+	ChecksumPrefixSHA256 = "sha256:"
+)
+
+// IsLegacyChecksum returns whether a checksum is in legacy MD5 format
+func IsLegacyChecksum(checksum string) bool {
+	return checksum != "" && !strings.HasPrefix(checksum, ChecksumPrefixSHA256)
+}
+
+func formatChecksum(h hash.Hash) string {
+	return ChecksumPrefixSHA256 + hex.EncodeToString(h.Sum(nil))
+}
+
 func checksumBytes(buf []byte) string {
+	h := sha256.New()
+	h.Write(buf)
+	return formatChecksum(h)
+}
+
+func legacyChecksumBytes(buf []byte) string {
 	h := md5.New()
 	h.Write(buf)
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func checksumFile(filename string) (checksum string, err error) {
-	h := md5.New()
-	if err = streamFile(h, filename); err != nil {
+// checksumFile returns checksum of content of a file, and legacy MD5 checksum
+func checksumFile(filename string) (checksum string, legacy string, err error) {
+	h, hl := sha256.New(), md5.New()
+	if err = streamFile(io.MultiWriter(h, hl), filename); err != nil {
 		return
 	}
-	checksum = hex.EncodeToString(h.Sum(nil))
+	checksum = formatChecksum(h)
+	legacy = hex.EncodeToString(hl.Sum(nil))
 	return
 }
 
-func checksumDir(dir string) (checksum string, err error) {
-	var filenames []string
-
+// walkChecksumFiles returns sorted regular files in dir covered by checksums, dot files and directories,
+// and paths matched by ignore are skipped
+func walkChecksumFiles(dir string, ignore *Ignore) (filenames []string, err error) {
 	if err = godirwalk.Walk(dir, &godirwalk.Options{
 		FollowSymbolicLinks: true,
-		Callback: func(filename string, entry *godirwalk.Dirent) error {
+		Callback: func(filename string, entry *godirwalk.Dirent) (err error) {
 			if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
 				return godirwalk.SkipThis
 			}
+			if filename != dir {
+				var ignored bool
+				if ignored, err = ignore.MatchFile(filename, entry.IsDir()); err != nil {
+					return
+				}
+				if ignored {
+					if entry.IsDir() {
+						return godirwalk.SkipThis
+					}
+					return
+				}
+			}
 			if entry.IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
 				filenames = append(filenames, filename)
 			}
-			return nil
+			return
 		},
 	}); err != nil {
 		return
 	}
 
 	sort.Strings(filenames)
+	return
+}
 
-	h := md5.New()
+// checksumDir returns checksum over relative path, mode and content of every file in dir, and legacy MD5
+// checksum over contents only; the legacy checksum covers ignored files as well, like previous versions did
+func checksumDir(dir string, ignore *Ignore) (checksum string, legacy string, err error) {
+	var filenames []string
+	if filenames, err = walkChecksumFiles(dir, ignore); err != nil {
+		return
+	}
+
+	h := sha256.New()
 	for _, filename := range filenames {
+		var info os.FileInfo
+		if info, err = os.Stat(filename); err != nil {
+			return
+		}
+		var rel string
+		if rel, err = filepath.Rel(dir, filename); err != nil {
+			return
+		}
+		// length prefixed, so that boundaries of files are unambiguous
+		fmt.Fprintf(h, "%s\x00%o\x00%d\x00", filepath.ToSlash(rel), info.Mode().Perm(), info.Size())
 		if err = streamFile(h, filename); err != nil {
 			return
 		}
-		h.Write([]byte{'\r', '\n'})
 	}
 
-	checksum = hex.EncodeToString(h.Sum(nil))
+	if filenames, err = walkChecksumFiles(dir, nil); err != nil {
+		return
+	}
+
+	hl := md5.New()
+	for _, filename := range filenames {
+		if err = streamFile(hl, filename); err != nil {
+			return
+		}
+		hl.Write([]byte{'\r', '\n'})
+	}
+
+	checksum = formatChecksum(h)
+	legacy = hex.EncodeToString(hl.Sum(nil))
 
 	return
 }
+
+// ChecksumStore state storing checksums by id
+type ChecksumStore interface {
+	Checksum(key string) string
+	SetChecksum(key string, checksum string)
+}
+
+// MigrateChecksums replace legacy checksums in store that still match current content with current checksums,
+// so that unchanged items are not applied again, returns number of migrated entries
+func MigrateChecksums(store ChecksumStore, res LoadResult) (migrated int) {
+	migrate := func(id string, checksum string, legacy string) {
+		if old := store.Checksum(id); IsLegacyChecksum(old) && old == legacy {
+			store.SetChecksum(id, checksum)
+			migrated++
+		}
+	}
+	for _, items := range [][]Resource{res.Resources, res.ResourcesExt} {
+		for _, item := range items {
+			migrate(item.ID, item.Checksum, item.LegacyChecksum)
+		}
+	}
+	for _, items := range [][]Hook{res.PreSyncHooks, res.PostSyncHooks} {
+		for _, item := range items {
+			migrate(item.ID, item.Checksum, item.LegacyChecksum)
+		}
+	}
+	for _, release := range res.Releases {
+		migrate(release.ID, release.Checksum, release.LegacyChecksum)
+	}
+	return
+}
@@ -2,21 +2,118 @@ package ezdeploy
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"github.com/stretchr/testify/require"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 )
 
 func TestChecksumFile(t *testing.T) {
-	s, err := checksumFile(filepath.Join("testdata", "streamfile.txt"))
+	s, legacy, err := checksumFile(filepath.Join("testdata", "streamfile.txt"))
 	require.NoError(t, err)
-	require.Equal(t, "3cb95cfbe1035bce8c448fcaf80fe7d9", s)
+	require.Equal(t, "3cb95cfbe1035bce8c448fcaf80fe7d9", legacy)
+	require.True(t, IsLegacyChecksum(legacy))
+	require.False(t, IsLegacyChecksum(s))
+
+	buf, err := os.ReadFile(filepath.Join("testdata", "streamfile.txt"))
+	require.NoError(t, err)
+	h := sha256.Sum256(buf)
+	require.Equal(t, ChecksumPrefixSHA256+hex.EncodeToString(h[:]), s)
 }
 
 func TestChecksumDir(t *testing.T) {
 	h := md5.Sum([]byte("hello\r\nhello\r\n"))
-	v, err := checksumDir(filepath.Join("testdata", "checksumdir"))
+	v, legacy, err := checksumDir(filepath.Join("testdata", "checksumdir"), nil)
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(h[:]), legacy)
+	require.True(t, len(v) > len(ChecksumPrefixSHA256))
+	require.False(t, IsLegacyChecksum(v))
+}
+
+func TestChecksumDirPathAndMode(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0640))
+
+	v1, l1, err := checksumDir(dir, nil)
+	require.NoError(t, err)
+
+	// rename
+	require.NoError(t, os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")))
+	v2, l2, err := checksumDir(dir, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, v1, v2)
+	require.Equal(t, l1, l2)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// mode
+	require.NoError(t, os.Chmod(filepath.Join(dir, "b.txt"), 0750))
+	v3, l3, err := checksumDir(dir, nil)
 	require.NoError(t, err)
-	require.Equal(t, hex.EncodeToString(h[:]), v)
+	require.NotEqual(t, v2, v3)
+	require.Equal(t, l2, l3)
+}
+
+func TestChecksumDirIgnore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "chart"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "chart", "1.txt"), []byte("hello"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "chart", "README.md"), []byte("world"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, IgnoreFile), []byte("*.md\n"), 0640))
+
+	ig, err := NewIgnore(root, nil)
+	require.NoError(t, err)
+
+	// ignored files are excluded from checksum, but not from legacy checksum, as previous versions had no ignore
+	checksum, legacy, err := checksumDir(filepath.Join(root, "chart"), ig)
+	require.NoError(t, err)
+	h := md5.Sum([]byte("hello\r\nworld\r\n"))
+	require.Equal(t, hex.EncodeToString(h[:]), legacy)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "chart", "README.md"), []byte("changed"), 0640))
+	checksum2, legacy2, err := checksumDir(filepath.Join(root, "chart"), ig)
+	require.NoError(t, err)
+	require.Equal(t, checksum, checksum2)
+	require.NotEqual(t, legacy, legacy2)
+}
+
+type mapChecksumStore map[string]string
+
+func (m mapChecksumStore) Checksum(key string) string {
+	return m[key]
+}
+
+func (m mapChecksumStore) SetChecksum(key string, val string) {
+	m[key] = val
+}
+
+func TestMigrateChecksums(t *testing.T) {
+	res := LoadResult{
+		Resources: []Resource{
+			{ID: "unchanged", Checksum: checksumBytes([]byte("a")), LegacyChecksum: legacyChecksumBytes([]byte("a"))},
+			{ID: "changed", Checksum: checksumBytes([]byte("b")), LegacyChecksum: legacyChecksumBytes([]byte("b"))},
+			{ID: "current", Checksum: checksumBytes([]byte("c")), LegacyChecksum: legacyChecksumBytes([]byte("c"))},
+		},
+		Releases: []Release{
+			{ID: "release", Checksum: checksumBytes([]byte("d")), LegacyChecksum: legacyChecksumBytes([]byte("d"))},
+		},
+	}
+	store := mapChecksumStore{
+		"unchanged": legacyChecksumBytes([]byte("a")),
+		"changed":   legacyChecksumBytes([]byte("x")),
+		"current":   checksumBytes([]byte("c")),
+		"release":   legacyChecksumBytes([]byte("d")),
+	}
+
+	require.Equal(t, 2, MigrateChecksums(store, res))
+	require.Equal(t, checksumBytes([]byte("a")), store["unchanged"])
+	require.Equal(t, legacyChecksumBytes([]byte("x")), store["changed"])
+	require.Equal(t, checksumBytes([]byte("c")), store["current"])
+	require.Equal(t, checksumBytes([]byte("d")), store["release"])
+	require.Equal(t, 0, MigrateChecksums(store, res))
 }
@@ -17,16 +17,31 @@ type KubernetesClientSource struct {
 	TemporaryDir   string
 }
 
+func (s KubernetesClientSource) restConfig() (cfg *rest.Config, err error) {
+	if s.InCluster {
+		return rest.InClusterConfig()
+	}
+	return clientcmd.BuildConfigFromFlags("", s.KubeconfigPath)
+}
+
 func (s KubernetesClientSource) Build() (client *kubernetes.Clientset, err error) {
 	var cfg *rest.Config
-	if s.InCluster {
-		if cfg, err = rest.InClusterConfig(); err != nil {
-			return
-		}
-	} else {
-		if cfg, err = clientcmd.BuildConfigFromFlags("", s.KubeconfigPath); err != nil {
-			return
-		}
+	if cfg, err = s.restConfig(); err != nil {
+		return
+	}
+	client, err = kubernetes.NewForConfig(cfg)
+	return
+}
+
+// BuildAs build a client impersonating a resolved identity
+func (s KubernetesClientSource) BuildAs(as Impersonation) (client *kubernetes.Clientset, err error) {
+	var cfg *rest.Config
+	if cfg, err = s.restConfig(); err != nil {
+		return
+	}
+	cfg.Impersonate = rest.ImpersonationConfig{
+		UserName: as.User,
+		Groups:   as.Groups,
 	}
 	client, err = kubernetes.NewForConfig(cfg)
 	return
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/yankeguo/ezdeploy"
+)
+
+type configOverrides struct {
+	Config         string
+	Root           string
+	Concurrency    int
+	OnError        string
+	StateNamespace string
+	StateName      string
+	StateStorage   string
+}
+
+// loadRootConfig load configuration file, defaults to the one in root, defaults are used if that is missing
+func loadRootConfig(file string, root string) (cfg ezdeploy.Config, err error) {
+	explicit := file != ""
+	if !explicit {
+		file = filepath.Join(root, ezdeploy.DefaultConfigFile)
+	}
+	if cfg, err = ezdeploy.LoadConfig(file); err != nil {
+		if explicit || !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+		cfg = ezdeploy.DefaultConfig()
+		cfg.Root = root
+	}
+	return
+}
+
+// resolveConfig load configuration file and apply overrides from explicitly set cli flags
+func resolveConfig(opts configOverrides) (cfg ezdeploy.Config, err error) {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var file string
+	if set["config"] {
+		file = opts.Config
+	}
+	root := "."
+	if set["root"] {
+		root = opts.Root
+	}
+
+	if cfg, err = loadRootConfig(file, root); err != nil {
+		return
+	}
+
+	if set["root"] {
+		cfg.Root = opts.Root
+	}
+	if set["concurrency"] {
+		cfg.Concurrency = opts.Concurrency
+	}
+	if set["on-error"] {
+		cfg.OnError = opts.OnError
+	}
+	if set["state-namespace"] {
+		cfg.State.Namespace = opts.StateNamespace
+	}
+	if set["state-name"] {
+		cfg.State.Name = opts.StateName
+	}
+	if set["state-storage"] {
+		cfg.State.Storage = opts.StateStorage
+	}
+
+	err = cfg.Validate()
+	return
+}
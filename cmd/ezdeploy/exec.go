@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+)
+
+var (
+	// commandGracePeriod time given to a cancelled command to exit after interrupted, before being killed
+	commandGracePeriod = time.Second * 30
+)
+
+func suffixedCommand(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+type runCommandOptions struct {
+	Logger      *slog.Logger
+	Name        string
+	Args        []string
+	Stdin       []byte
+	Kubeconfig  string
+	Impersonate ezdeploy.Impersonation
+	// Stdout optional writer capturing stdout, instead of emitting it as log events
+	Stdout io.Writer
+}
+
+// impersonateArgs returns impersonation flags of kubectl or helm
+func impersonateArgs(name string, as ezdeploy.Impersonation) (args []string) {
+	if as.User == "" {
+		return
+	}
+	flagUser, flagGroup := "--as", "--as-group"
+	if name == "helm" {
+		flagUser, flagGroup = "--kube-as-user", "--kube-as-group"
+	}
+	args = append(args, flagUser, as.User)
+	for _, group := range as.Groups {
+		args = append(args, flagGroup, group)
+	}
+	return
+}
+
+// runCommand execute kubectl or helm, output lines are emitted as log events
+func runCommand(ctx context.Context, opts runCommandOptions) (err error) {
+	args := opts.Args
+	if opts.Kubeconfig != "" {
+		args = append([]string{"--kubeconfig", opts.Kubeconfig}, args...)
+	}
+	args = append(impersonateArgs(opts.Name, opts.Impersonate), args...)
+
+	stdout := ezlog.NewEventWriter(opts.Logger, "command output", ezlog.KeyCommand, opts.Name, ezlog.KeyStream, "stdout")
+	defer stdout.Close()
+	stderr := ezlog.NewEventWriter(opts.Logger, "command output", ezlog.KeyCommand, opts.Name, ezlog.KeyStream, "stderr")
+	defer stderr.Close()
+
+	cmd := exec.CommandContext(ctx, suffixedCommand(opts.Name), args...)
+	if opts.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(opts.Stdin)
+	}
+	cmd.Stdout = stdout
+	if opts.Stdout != nil {
+		cmd.Stdout = opts.Stdout
+	}
+	cmd.Stderr = stderr
+	// interrupt instead of kill on cancellation, giving kubectl and helm a chance to exit gracefully
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = commandGracePeriod
+
+	startedAt := time.Now()
+	err = cmd.Run()
+
+	duration := time.Since(startedAt)
+	observeCommand(opts.Name, duration, err)
+
+	opts.Logger.Debug("command finished", ezlog.KeyCommand, opts.Name, ezlog.KeyDuration, duration)
+	return
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezkv"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+	"github.com/yankeguo/rg"
+	"k8s.io/client-go/kubernetes"
+)
+
+type runHooksOptions struct {
+	DB          *ezkv.KV
+	Record      ezkv.Record
+	Client      kubernetes.Interface
+	Logger      *slog.Logger
+	Report      *ezdeploy.NamespaceReport
+	Hooks       []ezdeploy.Hook
+	Namespace   string
+	Kubeconfig  string
+	Impersonate ezdeploy.Impersonation
+	DryRun      bool
+	Timeout     time.Duration
+}
+
+func runHooks(ctx context.Context, opts runHooksOptions) (err error) {
+	defer rg.Guard(&err)
+
+	for _, hook := range opts.Hooks {
+		logger := opts.Logger.With(ezlog.KeyHook, hook.Phase+"/"+hook.Object.Metadata.Name, ezlog.KeyPhase, hook.Phase)
+
+		if opts.DryRun {
+			logger.Info("hook skipped (dry run)")
+			continue
+		}
+
+		rg.Must0(runHook(ctx, opts, logger, hook))
+	}
+
+	return
+}
+
+func runHook(ctx context.Context, opts runHooksOptions, logger *slog.Logger, hook ezdeploy.Hook) (err error) {
+	item := ezdeploy.ReportItem{
+		ID:             hook.ID,
+		Kind:           ezdeploy.ReportKindHook,
+		Path:           hook.Path,
+		Outcome:        ezdeploy.OutcomeApplied,
+		ChecksumBefore: opts.DB.Checksum(hook.ID),
+		ChecksumAfter:  hook.Checksum,
+	}
+
+	startedAt := time.Now()
+	defer func() {
+		item.Duration = time.Since(startedAt).Seconds()
+		if err != nil {
+			item.Outcome = ezdeploy.OutcomeFailed
+			item.Error = err.Error()
+		}
+		opts.Report.Add(item)
+	}()
+
+	defer rg.Guard(&err)
+
+	name := hook.Object.Metadata.Name
+
+	if hook.HasDeletePolicy(ezdeploy.HookDeletePolicyBeforeHookCreation) {
+		rg.Must0(ezdeploy.DeleteJob(ctx, opts.Client, opts.Namespace, name))
+	}
+
+	rg.Must0(runCommand(ctx, runCommandOptions{
+		Logger:      logger,
+		Name:        "kubectl",
+		Args:        []string{"create", "-f", "-", "-n", opts.Namespace},
+		Stdin:       hook.Raw,
+		Kubeconfig:  opts.Kubeconfig,
+		Impersonate: opts.Impersonate,
+	}))
+
+	logger.Info("waiting for hook")
+
+	wctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	if err = ezdeploy.WaitForRollout(wctx, opts.Client, opts.Namespace, hook.Object, ezdeploy.DefaultRolloutInterval); err != nil {
+		if hook.HasDeletePolicy(ezdeploy.HookDeletePolicyHookFailed) {
+			_ = ezdeploy.DeleteJob(ctx, opts.Client, opts.Namespace, name)
+		}
+		return
+	}
+
+	if hook.HasDeletePolicy(ezdeploy.HookDeletePolicyHookSucceeded) {
+		rg.Must0(ezdeploy.DeleteJob(ctx, opts.Client, opts.Namespace, name))
+	}
+
+	opts.DB.Put(hook.ID, newRecord(opts.Record, ezkv.ModeHook, hook.Checksum, hook.Path))
+
+	logger.Info("hook succeeded", ezlog.KeyDuration, time.Since(startedAt))
+
+	return
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
-	"runtime"
-	"strings"
+	"time"
 
 	"github.com/yankeguo/ezdeploy"
 	"github.com/yankeguo/ezdeploy/pkg/ezkv"
@@ -17,196 +14,43 @@ import (
 	"github.com/yankeguo/ezdeploy/pkg/ezsync"
 	"github.com/yankeguo/ezdeploy/pkg/eztmp"
 	"github.com/yankeguo/rg"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 )
 
-func suffixedCommand(name string) string {
-	if runtime.GOOS == "windows" {
-		return name + ".exe"
-	}
-	return name
-}
-
-type syncNamespaceOptions struct {
-	DB         *ezkv.KV
-	Kubeconfig string
-	Root       string
-	Namespace  string
-	Charts     map[string]ezdeploy.Chart
-	DryRun     bool
-}
-
-func syncNamespace(ctx context.Context, opts syncNamespaceOptions) (err error) {
-	defer rg.Guard(&err)
-
-	title := "[" + opts.Namespace + "]"
-	log.Println(title, "scanning")
-
-	res := rg.Must(ezdeploy.Load(opts.Root, opts.Namespace, ezdeploy.LoadOptions{Charts: opts.Charts}))
-
-	rg.Must0(syncResources(ctx, syncResourcesOptions{
-		DB:         opts.DB,
-		Resources:  res.Resources,
-		Title:      title,
-		Namespace:  opts.Namespace,
-		Kubeconfig: opts.Kubeconfig,
-		DryRun:     opts.DryRun,
-	}))
-
-	rg.Must0(syncResources(ctx, syncResourcesOptions{
-		DB:         opts.DB,
-		Resources:  res.ResourcesExt,
-		Title:      title,
-		Namespace:  "",
-		Kubeconfig: opts.Kubeconfig,
-		DryRun:     opts.DryRun,
-	}))
-
-	for _, release := range res.Releases {
-		rg.Must0(syncRelease(ctx, syncReleaseOptions{
-			DB:         opts.DB,
-			Release:    release,
-			Title:      title + " [Helm:" + release.Name + "]",
-			Namespace:  opts.Namespace,
-			Kubeconfig: opts.Kubeconfig,
-			DryRun:     opts.DryRun,
-		}))
-	}
-
-	return
-}
-
-type syncResourcesOptions struct {
-	DB         *ezkv.KV
-	Resources  []ezdeploy.Resource
-	Title      string
-	Namespace  string
-	Kubeconfig string
-	DryRun     bool
-}
-
-func syncResources(ctx context.Context, opts syncResourcesOptions) (err error) {
-	defer rg.Guard(&err)
-
-	var resources []ezdeploy.Resource
-
-	for _, res := range opts.Resources {
-		if opts.DB.Get(res.ID) == res.Checksum {
-			continue
-		}
-		resources = append(resources, res)
-	}
-
-	if len(resources) == 0 {
-		return
-	}
-
-	var raws []json.RawMessage
-	for _, res := range resources {
-		raws = append(raws, res.Raw)
-	}
-
-	buf := rg.Must(json.Marshal(ezdeploy.NewList(raws)))
-
-	args := []string{"apply", "-f", "-"}
-
-	if opts.Kubeconfig != "" {
-		args = append([]string{"--kubeconfig", opts.Kubeconfig}, args...)
-	}
-
-	if opts.Namespace != "" {
-		args = append(args, "-n", opts.Namespace)
-	}
-
-	if opts.DryRun {
-		args = append(args, "--dry-run=server")
-	}
-
-	cmd := exec.CommandContext(ctx, suffixedCommand("kubectl"), args...)
-	cmd.Stdin = bytes.NewReader(buf)
-	cmd.Stdout = ezlog.NewLogWriter(log.Default(), opts.Title)
-	cmd.Stderr = ezlog.NewLogWriter(log.Default(), opts.Title)
-	rg.Must0(cmd.Run())
-
-	if !opts.DryRun {
-		for _, res := range resources {
-			opts.DB.Put(res.ID, res.Checksum)
-		}
-	}
-
-	if opts.DryRun {
-		log.Println(opts.Title, "resources synced (dry run)")
-	} else {
-		log.Println(opts.Title, "resources synced")
-	}
-
-	return
-}
-
-type syncReleaseOptions struct {
-	DB         *ezkv.KV
-	Release    ezdeploy.Release
-	Title      string
-	Namespace  string
-	Kubeconfig string
-	DryRun     bool
-}
-
-func syncRelease(ctx context.Context, opts syncReleaseOptions) (err error) {
-	defer rg.Guard(&err)
-
-	if opts.DB.Get(opts.Release.ID) == opts.Release.Checksum {
-		return
+var (
+	subcommands = map[string]func(args []string) error{
+		"sign":  runSign,
+		"state": runState,
 	}
+)
 
-	valuesFile := opts.Release.ValuesFile
+func main() {
+	var err error
 
-	// convert jsonnet file to yaml file
-	if strings.HasSuffix(opts.Release.ValuesFile, ezdeploy.SuffixHelmValuesJSONNet) {
-		if valuesFile, err = ezdeploy.ConvertJSONNetFileToYAML(valuesFile, opts.Namespace); err != nil {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err = cmd(os.Args[2:]); err != nil {
+				slog.Error("exited with error", ezlog.KeyError, err.Error())
+				os.Exit(1)
+			}
 			return
 		}
 	}
 
-	args := []string{
-		"upgrade", "--install",
-		"--namespace", opts.Namespace,
-		opts.Release.Name, opts.Release.Chart.Path,
-		"-f", valuesFile,
-	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 
-	if opts.Kubeconfig != "" {
-		args = append([]string{"--kubeconfig", opts.Kubeconfig}, args...)
-	}
-
-	if opts.DryRun {
-		args = append(args, "--dry-run")
-	}
-
-	cmd := exec.CommandContext(ctx, suffixedCommand("helm"), args...)
-	cmd.Stdout = ezlog.NewLogWriter(log.Default(), opts.Title)
-	cmd.Stderr = ezlog.NewLogWriter(log.Default(), opts.Title)
-	rg.Must0(cmd.Run())
-
-	if !opts.DryRun {
-		opts.DB.Put(opts.Release.ID, opts.Release.Checksum)
-	}
-
-	if opts.DryRun {
-		log.Println(opts.Title, "release synced (dry run)")
-	} else {
-		log.Println(opts.Title, "release synced")
-	}
-
-	return
-}
-
-func main() {
-	var err error
 	defer func() {
+		if interrupted.Load() {
+			if err != nil {
+				logger.Error("interrupted", ezlog.KeyError, err.Error())
+			}
+			os.Exit(exitCodeInterrupted)
+		}
 		if err == nil {
 			return
 		}
-		log.Println("exited with error:", err.Error())
+		logger.Error("exited with error", ezlog.KeyError, err.Error())
 		os.Exit(1)
 	}()
 	defer rg.Guard(&err)
@@ -214,52 +58,215 @@ func main() {
 
 	// cli options
 	var (
-		optDryRun     bool
-		optKubeconfig string
+		optDryRun      bool
+		optKubeconfig  string
+		optWait        bool
+		optWaitTimeout time.Duration
+		optGrace       time.Duration
+		optLogFormat   string
+		optLogLevel    string
+		optReport      string
+		optReportJUnit string
+		optMetricsFile string
+		optMetricsPush string
+		optMetricsJob  string
+		optStatus      bool
+		optShowSecrets bool
+		optVerifyKey   string
+		optOverrides   configOverrides
 	)
 
+	flag.StringVar(&optOverrides.Config, "config", "", "path to config file, defaults to '"+ezdeploy.DefaultConfigFile+"' in root")
+	flag.StringVar(&optOverrides.Root, "root", ".", "path to resource root")
+	flag.IntVar(&optOverrides.Concurrency, "concurrency", ezdeploy.DefaultConcurrency, "maximum number of namespaces synced concurrently")
+	flag.StringVar(&optOverrides.OnError, "on-error", ezdeploy.OnErrorContinue, "error policy, '"+ezdeploy.OnErrorContinue+"' finishes everything and reports, '"+ezdeploy.OnErrorFailFast+"' cancels the whole run on first error")
+	flag.StringVar(&optOverrides.StateNamespace, "state-namespace", ezdeploy.DefaultStateNamespace, "namespace of state")
+	flag.StringVar(&optOverrides.StateName, "state-name", ezdeploy.DefaultStateName, "name of state")
+	flag.StringVar(&optOverrides.StateStorage, "state-storage", ezdeploy.StateStorageSecret, "kind of objects storing state, 'secret' or 'configmap'")
 	flag.BoolVar(&optDryRun, "dry-run", false, "dry run (server)")
 	flag.StringVar(&optKubeconfig, "kubeconfig", "", "path to kubeconfig")
+	flag.BoolVar(&optWait, "wait", false, "wait for rollouts of applied workloads")
+	flag.DurationVar(&optWaitTimeout, "wait-timeout", time.Minute*5, "timeout of waiting for rollouts per namespace, and for each hook")
+	flag.DurationVar(&optGrace, "grace-period", commandGracePeriod, "time given to running kubectl and helm to exit after interrupted, before being killed")
+	flag.StringVar(&optLogFormat, "log-format", ezlog.FormatText, "log format, 'text' or 'json'")
+	flag.StringVar(&optLogLevel, "log-level", "info", "log level, 'debug', 'info', 'warn' or 'error'")
+	flag.StringVar(&optReport, "report", "", "path to write run report in JSON")
+	flag.StringVar(&optReportJUnit, "report-junit", "", "path to write run report in JUnit XML")
+	flag.StringVar(&optMetricsFile, "metrics-textfile", "", "path to write metrics in Prometheus text format, for node-exporter textfile collector")
+	flag.StringVar(&optMetricsPush, "metrics-push-url", "", "url of a Pushgateway compatible endpoint to push metrics")
+	flag.StringVar(&optMetricsJob, "metrics-job", "ezdeploy", "job name used when pushing metrics")
+	flag.StringVar(&optVerifyKey, "verify-key", "", "path to PEM encoded ed25519 public key, refuse to run unless resource root matches its signed manifest")
+	flag.BoolVar(&optShowSecrets, "show-secrets", false, "do not redact Secret data and sensitive values from logs and reports, for local debugging only")
+	flag.BoolVar(&optStatus, "publish-status", false, "publish run status as ConfigMap '"+ezdeploy.StatusConfigMapName+"' and Events in every namespace")
 	flag.Parse()
 
-	// context
+	// logger
+	logger = rg.Must(ezlog.New(os.Stderr, optLogFormat, optLogLevel))
+	klog.SetSlogLogger(logger)
+
+	// config
+	cfg := rg.Must(resolveConfig(optOverrides))
+
+	// redaction, all output goes through logger and report
+	if !optShowSecrets {
+		redactor = rg.Must(cfg.NewRedactor())
+		logger = slog.New(ezlog.NewRedactHandler(logger.Handler(), redactor.Redact))
+		klog.SetSlogLogger(logger)
+	}
+
+	commandGracePeriod = optGrace
+
+	// verify signature before anything touches the cluster
+	ignore := rg.Must(cfg.NewIgnore())
+	if optVerifyKey != "" {
+		rg.Must0(ezdeploy.VerifyRoot(cfg.Root, ignore, rg.Must(ezdeploy.LoadPublicKey(optVerifyKey))))
+		logger.Info("signature verified", ezlog.KeyPhase, "verify")
+	}
+
+	// context, ctx outlives interruption for saving state and reporting, runCtx is cancelled on SIGINT or SIGTERM
 	ctx := context.Background()
+	runCtx, stop := withInterrupt(ctx, logger)
+	defer stop()
 
 	// kubernetes client source
 	cs := rg.Must(ezdeploy.ResolveKubernetesClient(optKubeconfig))
 	defer cs.CleanUp()
 
 	if cs.InCluster {
-		log.Println("using in-cluster credentials")
+		logger.Info("using in-cluster credentials")
 	} else {
-		log.Println("using kubeconfig:", cs.KubeconfigPath)
+		logger.Info("using kubeconfig", "kubeconfig", cs.KubeconfigPath)
 	}
 
 	// client
 	client := rg.Must(cs.Build())
 
+	// state client, impersonating the identity configured for state
+	var stateClient kubernetes.Interface = client
+	if as := cfg.StateImpersonation(); !as.IsZero() {
+		stateClient = rg.Must(cs.BuildAs(as))
+		logger.Info("impersonating for state", "user", as.User, "groups", as.Groups)
+	}
+
 	// ezkv database
-	db := rg.Must(ezkv.Open(ctx, ezkv.Options{
-		Client:    client,
-		Namespace: "default",
-		Name:      "ezdeploy",
+	startedAt := time.Now()
+	db := rg.Must(ezkv.Open(runCtx, ezkv.Options{
+		Storage:   cfg.NewStateStorage(stateClient),
+		Namespace: cfg.State.Namespace,
+		Name:      cfg.State.Name,
+		OnChunks:  observeStateChunks,
+		OnFallback: func(revision string, previous string, err error) {
+			logger.Error(
+				"state is corrupted, falling back to previous revision, changes of the last run may be re-applied",
+				ezlog.KeyPhase, "state", "revision", revision, "previous", previous, ezlog.KeyError, err.Error(),
+			)
+		},
 	}))
+	observeState("load", time.Since(startedAt))
+	logger.Debug("state loaded", ezlog.KeyPhase, "state", ezlog.KeyDuration, time.Since(startedAt))
+
+	// metrics are written after state is saved
+	defer func() {
+		if err := writeMetrics(ctx, optMetricsFile, optMetricsPush, optMetricsJob); err != nil {
+			logger.Error("failed to write metrics", ezlog.KeyError, err.Error())
+		}
+	}()
+
 	defer func() {
-		_ = db.Save(ctx)
+		startedAt := time.Now()
+		if err := db.Save(ctx); err != nil {
+			logger.Error("failed to save state", ezlog.KeyPhase, "state", ezlog.KeyError, err.Error())
+			return
+		}
+		observeState("save", time.Since(startedAt))
+		logger.Debug("state saved", ezlog.KeyPhase, "state", ezlog.KeyDuration, time.Since(startedAt))
 	}()
 
+	// state is checkpointed after each namespace, coalesced, and saved once more at exit
+	checkpointer := db.NewCheckpointer(ctx, ezkv.CheckpointOptions{
+		OnSave: func(duration time.Duration, err error) {
+			if err != nil {
+				logger.Warn("failed to checkpoint state", ezlog.KeyPhase, "state", ezlog.KeyError, err.Error())
+				return
+			}
+			observeState("checkpoint", duration)
+			logger.Debug("state checkpointed", ezlog.KeyPhase, "state", ezlog.KeyDuration, duration)
+		},
+	})
+	defer checkpointer.Close()
+
+	// cluster scoped kinds for namespace guard
+	var kinds ezdeploy.ClusterScopedKinds
+	if cfg.NamespaceGuard.Enabled() {
+		kinds = rg.Must(ezdeploy.DiscoverClusterScopedKinds(client.Discovery()))
+	}
+
 	// scan
-	result := rg.Must(ezdeploy.Scan("."))
+	result := rg.Must(ezdeploy.Scan(cfg.Root, cfg.ScanOptions(ignore)))
+
+	// report
+	report := ezdeploy.NewReport(optDryRun)
+	report.GitCommit = ezdeploy.ResolveGitCommit(cfg.Root)
+
+	logger.Info("run started", ezlog.KeyRunID, report.RunID, ezlog.KeyVersion, report.Version, ezlog.KeyCommit, report.GitCommit)
+
+	// sync namespaces, with fail-fast, the first error cancels in-flight commands and skips queued namespaces
+	err = ezsync.DoParaCtx(runCtx, result.Namespaces, cfg.Concurrency, cfg.FailFast(), func(namespace string) string {
+		return namespace
+	}, func(ctx context.Context, namespace string) (err error) {
+		defer checkpointer.Request()
+
+		// waits and hooks use the impersonated identity, state is shared thus uses the identity configured for state
+		as := cfg.ImpersonationFor(namespace)
+		var nsClient kubernetes.Interface = client
+		if !as.IsZero() {
+			if nsClient, err = cs.BuildAs(as); err != nil {
+				return
+			}
+			logger.Info("impersonating", ezlog.KeyNamespace, namespace, "user", as.User, "groups", as.Groups)
+		}
 
-	// sync namespaces
-	err = ezsync.DoPara(ctx, result.Namespaces, 5, func(ctx context.Context, namespace string) (err error) {
 		return syncNamespace(ctx, syncNamespaceOptions{
-			DB:         db,
-			Kubeconfig: cs.KubeconfigPath,
-			Root:       ".",
-			Namespace:  namespace,
-			Charts:     result.Charts,
-			DryRun:     optDryRun,
+			DB:              db,
+			Client:          nsClient,
+			Logger:          logger,
+			Report:          report,
+			Kubeconfig:      cs.KubeconfigPath,
+			Impersonate:     as,
+			Root:            cfg.Root,
+			Namespace:       namespace,
+			LoadOptions:     cfg.LoadOptions(result.Charts, ignore),
+			DryRun:          optDryRun,
+			Wait:            optWait,
+			WaitTimeout:     optWaitTimeout,
+			Policy:          cfg.Policy.ForNamespace(namespace),
+			Guard:           cfg.NamespaceGuard,
+			Kinds:           kinds,
+			ContinueOnError: !cfg.FailFast(),
 		})
 	})
+
+	var errs ezsync.ItemErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if errors.Is(e.Err, ezsync.ErrSkipped) {
+				logger.Warn("namespace skipped", ezlog.KeyNamespace, e.Item, ezlog.KeyError, e.Err.Error())
+				report.Namespace(e.Item).Finish(0, e.Err)
+			}
+		}
+	}
+
+	report.Finish(err)
+	report.Redact(redactor.Redact)
+	observeReport(report)
+
+	if optStatus && !optDryRun {
+		publishStatus(ctx, client, logger, report)
+	}
+
+	notifyWebhooks(ctx, logger, cfg.Webhooks, report)
+
+	if err := writeReports(report, optReport, optReportJUnit); err != nil {
+		logger.Error("failed to write report", ezlog.KeyError, err.Error())
+	}
 }
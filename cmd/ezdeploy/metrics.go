@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezmetrics"
+)
+
+var (
+	metrics = ezmetrics.NewRegistry()
+)
+
+func observeCommand(name string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.ObserveHistogram(
+		"ezdeploy_command_duration_seconds",
+		"Duration of kubectl and helm invocations.",
+		ezmetrics.DefaultBuckets,
+		ezmetrics.Labels{"command": name, "result": result},
+		duration.Seconds(),
+	)
+}
+
+func observeState(op string, duration time.Duration) {
+	metrics.ObserveHistogram(
+		"ezdeploy_state_duration_seconds",
+		"Duration of loading and saving the state.",
+		ezmetrics.DefaultBuckets,
+		ezmetrics.Labels{"operation": op},
+		duration.Seconds(),
+	)
+}
+
+func observeStateChunks(op string, chunks int) {
+	metrics.AddCounter(
+		"ezdeploy_state_chunks_total",
+		"Number of ezblob chunks loaded and saved.",
+		ezmetrics.Labels{"operation": op},
+		float64(chunks),
+	)
+}
+
+// observeReport record counters of a finished run
+func observeReport(report *ezdeploy.Report) {
+	for _, nr := range report.Namespaces {
+		for _, item := range nr.Items {
+			var name, help string
+			switch item.Kind {
+			case ezdeploy.ReportKindRelease:
+				name, help = "ezdeploy_releases_total", "Number of Helm releases by outcome."
+			case ezdeploy.ReportKindHook:
+				name, help = "ezdeploy_hooks_total", "Number of hooks by outcome."
+			default:
+				name, help = "ezdeploy_resources_total", "Number of resources by outcome."
+			}
+			metrics.AddCounter(name, help, ezmetrics.Labels{"namespace": nr.Namespace, "outcome": string(item.Outcome)}, 1)
+		}
+
+		var failed float64
+		if nr.Error != "" {
+			failed = 1
+		}
+		metrics.SetGauge(
+			"ezdeploy_namespace_failed",
+			"Whether syncing the namespace failed in the last run.",
+			ezmetrics.Labels{"namespace": nr.Namespace},
+			failed,
+		)
+		metrics.ObserveHistogram(
+			"ezdeploy_namespace_duration_seconds",
+			"Duration of syncing a namespace.",
+			ezmetrics.DefaultBuckets,
+			ezmetrics.Labels{"namespace": nr.Namespace},
+			nr.Duration,
+		)
+	}
+
+	var success float64
+	if report.Error == "" {
+		success = 1
+	}
+	metrics.SetGauge("ezdeploy_run_success", "Whether the last run succeeded.", nil, success)
+	metrics.SetGauge("ezdeploy_run_duration_seconds", "Duration of the last run.", nil, report.FinishedAt.Sub(report.StartedAt).Seconds())
+	metrics.SetGauge("ezdeploy_run_timestamp_seconds", "Finish time of the last run.", nil, float64(report.FinishedAt.Unix()))
+}
+
+// writeMetrics write metrics to a textfile and push to a Pushgateway, empty destinations are skipped
+func writeMetrics(ctx context.Context, textfile string, pushURL string, job string) (err error) {
+	if textfile != "" {
+		if err = metrics.WriteTextfile(textfile); err != nil {
+			return
+		}
+	}
+	if pushURL != "" {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+		defer cancel()
+		if err = metrics.Push(ctx, pushURL, job); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+)
+
+// checkPolicy check resources against policy
+func checkPolicy(logger *slog.Logger, report *ezdeploy.NamespaceReport, policy ezdeploy.Policy, resources []ezdeploy.Resource) error {
+	violations, err := policy.CheckAll(resources)
+	return reportViolations(logger, report, resources, violations, err)
+}
+
+// checkNamespaceGuard check resources of a namespace directory against namespace guard
+func checkNamespaceGuard(logger *slog.Logger, report *ezdeploy.NamespaceReport, guard ezdeploy.NamespaceGuardConfig, kinds ezdeploy.ClusterScopedKinds, namespace string, resources []ezdeploy.Resource) error {
+	violations, err := guard.Check(namespace, resources, kinds)
+	return reportViolations(logger, report, resources, violations, err)
+}
+
+// reportViolations log violations, and report denied resources as failed if err is not nil
+func reportViolations(logger *slog.Logger, report *ezdeploy.NamespaceReport, resources []ezdeploy.Resource, violations []ezdeploy.PolicyViolation, err error) error {
+	denied := map[string][]string{}
+
+	for _, v := range violations {
+		if v.Severity == ezdeploy.SeverityDeny {
+			logger.Error("policy denied", ezlog.KeyPhase, "policy", ezlog.KeyResource, v.ID, "rule", v.Rule, ezlog.KeyError, v.Message)
+			denied[v.ID] = append(denied[v.ID], v.Rule+": "+v.Message)
+		} else {
+			logger.Warn("policy violated", ezlog.KeyPhase, "policy", ezlog.KeyResource, v.ID, "rule", v.Rule, ezlog.KeyError, v.Message)
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	for _, res := range resources {
+		if messages, ok := denied[res.ID]; ok {
+			report.Add(ezdeploy.ReportItem{
+				ID:            res.ID,
+				Kind:          ezdeploy.ReportKindResource,
+				Object:        reportObject(res),
+				Path:          res.Path,
+				Outcome:       ezdeploy.OutcomeFailed,
+				ChecksumAfter: res.Checksum,
+				Error:         strings.Join(messages, "; "),
+			})
+			delete(denied, res.ID)
+		}
+	}
+	return err
+}
+
+// renderRelease render manifests of a release with 'helm template' for policy checks
+func renderRelease(ctx context.Context, opts syncReleaseOptions, valuesFile string) (out []byte, err error) {
+	buf := &bytes.Buffer{}
+	if err = runCommand(ctx, runCommandOptions{
+		Logger: opts.Logger.With(ezlog.KeyPhase, "policy"),
+		Name:   "helm",
+		Args: []string{
+			"template",
+			"--namespace", opts.Namespace,
+			opts.Release.Name, opts.Release.Chart.Path,
+			"-f", valuesFile,
+		},
+		Stdout:      buf,
+		Kubeconfig:  opts.Kubeconfig,
+		Impersonate: opts.Impersonate,
+	}); err != nil {
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// checkRelease register sensitive values of rendered manifests of a release, and check them against namespace
+// guard and policy
+func checkRelease(opts syncReleaseOptions, out []byte) (err error) {
+	var rendered []ezdeploy.Resource
+	if rendered, err = ezdeploy.ParseManifests(opts.Namespace, opts.Release.ValuesFile, out); err != nil {
+		return
+	}
+	for _, res := range rendered {
+		redactor.AddObject(res.Raw)
+	}
+	if err = checkNamespaceGuard(opts.Logger, opts.Report, opts.Guard, opts.Kinds, opts.Namespace, rendered); err != nil {
+		return
+	}
+	if err = checkPolicy(opts.Logger, opts.Report, opts.Policy, rendered); err != nil {
+		return
+	}
+	return
+}
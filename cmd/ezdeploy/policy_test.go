@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezdeploy"
+)
+
+func TestCheckRelease(t *testing.T) {
+	report := ezdeploy.NewReport(false).Namespace("default")
+
+	opts := syncReleaseOptions{
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Report:    report,
+		Release:   ezdeploy.Release{ID: ezdeploy.CreateReleaseID("default", "demo"), Name: "demo", ValuesFile: "default/demo.helm.yaml"},
+		Namespace: "default",
+		Policy:    ezdeploy.Policy{Rules: map[string]string{ezdeploy.PolicyNoLatestTag: ezdeploy.SeverityDeny}},
+	}
+
+	out := []byte(`
+---
+# Source: demo/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+spec:
+  template:
+    spec:
+      containers:
+        - name: main
+          image: nginx:latest
+`)
+
+	err := checkRelease(opts, out)
+	require.True(t, errors.Is(err, ezdeploy.ErrPolicyDenied))
+	require.Len(t, report.Items, 1)
+	require.Equal(t, ezdeploy.OutcomeFailed, report.Items[0].Outcome)
+
+	opts.Policy = ezdeploy.Policy{}
+	require.NoError(t, checkRelease(opts, out))
+}
+
+func TestCheckReleaseNamespaceGuard(t *testing.T) {
+	report := ezdeploy.NewReport(false).Namespace("team-a")
+
+	opts := syncReleaseOptions{
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Report:    report,
+		Release:   ezdeploy.Release{ID: ezdeploy.CreateReleaseID("team-a", "demo"), Name: "demo", ValuesFile: "team-a/demo.helm.yaml"},
+		Namespace: "team-a",
+		Guard:     ezdeploy.NamespaceGuardConfig{Mode: ezdeploy.SeverityDeny},
+		Kinds:     ezdeploy.ClusterScopedKinds{},
+	}
+
+	out := []byte(`
+---
+# Source: demo/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: own
+---
+# Source: demo/templates/escape.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: escape
+  namespace: kube-system
+`)
+
+	err := checkRelease(opts, out)
+	require.True(t, errors.Is(err, ezdeploy.ErrNamespaceGuardDenied))
+	require.Len(t, report.Items, 1)
+	require.Equal(t, "kube-system::v1/ConfigMap/escape", report.Items[0].ID)
+}
+
+func TestCheckReleaseRedact(t *testing.T) {
+	var err error
+	redactor, err = ezdeploy.NewRedactor(nil)
+	require.NoError(t, err)
+	defer func() { redactor = nil }()
+
+	opts := syncReleaseOptions{
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Report:    ezdeploy.NewReport(false).Namespace("default"),
+		Release:   ezdeploy.Release{ID: ezdeploy.CreateReleaseID("default", "demo"), Name: "demo", ValuesFile: "default/demo.helm.yaml"},
+		Namespace: "default",
+	}
+
+	// 'c3VwZXItc2VjcmV0LTE=' is 'super-secret-1'
+	require.NoError(t, checkRelease(opts, []byte(`
+---
+# Source: demo/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+data:
+  credential: c3VwZXItc2VjcmV0LTE=
+`)))
+
+	out := redactor.Redact("credential: c3VwZXItc2VjcmV0LTE= super-secret-1")
+	require.NotContains(t, out, "c3VwZXItc2VjcmV0LTE=")
+	require.NotContains(t, out, "super-secret-1")
+}
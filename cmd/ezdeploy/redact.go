@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+)
+
+var (
+	// redactor masks sensitive values in logs and reports, nil when secrets are shown
+	redactor *ezdeploy.Redactor
+)
+
+// registerSecrets register sensitive values of all loaded resources and hooks
+func registerSecrets(res ezdeploy.LoadResult) {
+	for _, item := range concatResources(res) {
+		redactor.AddObject(item.Raw)
+	}
+}
+
+// registerReleaseSecrets register sensitive values of manifests of a release, before output of 'helm upgrade' is
+// logged; manifests are taken from the output itself for dry runs, which prints them, and from 'helm get manifest'
+// otherwise. Failures are logged, output is still masked by values file and loaded resources.
+func registerReleaseSecrets(ctx context.Context, opts syncReleaseOptions, out []byte) {
+	if redactor == nil {
+		return
+	}
+
+	var manifests []byte
+	if opts.DryRun {
+		manifests = helmOutputManifests(out)
+	} else {
+		buf := &bytes.Buffer{}
+		if err := runCommand(ctx, runCommandOptions{
+			Logger:      opts.Logger.With(ezlog.KeyPhase, "release"),
+			Name:        "helm",
+			Args:        []string{"get", "manifest", "--namespace", opts.Namespace, opts.Release.Name},
+			Stdout:      buf,
+			Kubeconfig:  opts.Kubeconfig,
+			Impersonate: opts.Impersonate,
+		}); err != nil {
+			opts.Logger.Warn("failed to get manifests of release for redaction", ezlog.KeyPhase, "release", ezlog.KeyError, err.Error())
+			return
+		}
+		manifests = buf.Bytes()
+	}
+
+	resources, err := ezdeploy.ParseManifests(opts.Namespace, opts.Release.ValuesFile, manifests)
+	if err != nil {
+		opts.Logger.Warn("failed to parse manifests of release for redaction", ezlog.KeyPhase, "release", ezlog.KeyError, err.Error())
+		return
+	}
+	for _, res := range resources {
+		redactor.AddObject(res.Raw)
+	}
+}
+
+// helmOutputManifests extract hooks and manifests from output of 'helm upgrade --dry-run', between the 'HOOKS:'
+// or 'MANIFEST:' line and the 'NOTES:' line
+func helmOutputManifests(out []byte) []byte {
+	var (
+		buf     bytes.Buffer
+		inside  bool
+		scanner = bufio.NewScanner(bytes.NewReader(out))
+	)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch strings.TrimSpace(line) {
+		case "HOOKS:", "MANIFEST:":
+			inside = true
+			continue
+		case "NOTES:":
+			inside = false
+			continue
+		}
+		if inside {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
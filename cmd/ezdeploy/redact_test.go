@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezdeploy"
+)
+
+func TestRegisterReleaseSecrets(t *testing.T) {
+	var err error
+	redactor, err = ezdeploy.NewRedactor(nil)
+	require.NoError(t, err)
+	defer func() { redactor = nil }()
+
+	opts := syncReleaseOptions{
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Release:   ezdeploy.Release{ID: ezdeploy.CreateReleaseID("default", "demo"), Name: "demo", ValuesFile: "default/demo.helm.yaml"},
+		Namespace: "default",
+		DryRun:    true,
+	}
+
+	// 'Z2VuZXJhdGVkLXNlY3JldA==' is 'generated-secret'
+	out := []byte(`Release "demo" has been upgraded. Happy Helming!
+NAME: demo
+NAMESPACE: default
+STATUS: pending-upgrade
+HOOKS:
+MANIFEST:
+---
+# Source: demo/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+data:
+  credential: Z2VuZXJhdGVkLXNlY3JldA==
+---
+# Source: demo/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+data:
+  mode: production
+
+NOTES:
+Thank you for installing demo.
+`)
+
+	require.Contains(t, string(helmOutputManifests(out)), "kind: ConfigMap")
+	require.NotContains(t, string(helmOutputManifests(out)), "NOTES")
+
+	registerReleaseSecrets(context.Background(), opts, out)
+
+	masked := redactor.Redact(string(out))
+	require.NotContains(t, masked, "Z2VuZXJhdGVkLXNlY3JldA==")
+	require.Contains(t, masked, "mode: production")
+	require.Contains(t, masked, "Thank you for installing demo.")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/yankeguo/ezdeploy"
+)
+
+func writeReportFile(file string, fn func(f *os.File) error) (err error) {
+	var f *os.File
+	if f, err = os.Create(file); err != nil {
+		return
+	}
+	defer f.Close()
+	if err = fn(f); err != nil {
+		return
+	}
+	return f.Close()
+}
+
+// writeReports write the run report as JSON and JUnit XML, empty file names are skipped
+func writeReports(report *ezdeploy.Report, fileJSON string, fileJUnit string) (err error) {
+	if fileJSON != "" {
+		if err = writeReportFile(fileJSON, func(f *os.File) error {
+			return report.WriteJSON(f)
+		}); err != nil {
+			return
+		}
+	}
+	if fileJUnit != "" {
+		if err = writeReportFile(fileJUnit, func(f *os.File) error {
+			return report.WriteJUnit(f)
+		}); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/yankeguo/ezdeploy"
+)
+
+// runSign sign manifest of resource root, or generate a key pair
+func runSign(args []string) (err error) {
+	var (
+		optConfig   string
+		optRoot     string
+		optKey      string
+		optGenerate string
+	)
+
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	fs.StringVar(&optConfig, "config", "", "path to config file, defaults to '"+ezdeploy.DefaultConfigFile+"' in root")
+	fs.StringVar(&optRoot, "root", ".", "path to resource root")
+	fs.StringVar(&optKey, "key", "", "path to PEM encoded ed25519 private key")
+	fs.StringVar(&optGenerate, "generate-key", "", "generate a key pair, write private key to this path and public key with suffix '.pub', then exit")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if optGenerate != "" {
+		var priv, pub []byte
+		if priv, pub, err = ezdeploy.GenerateSigningKey(); err != nil {
+			return
+		}
+		if err = os.WriteFile(optGenerate, priv, 0600); err != nil {
+			return
+		}
+		return os.WriteFile(optGenerate+".pub", pub, 0644)
+	}
+
+	if optKey == "" {
+		return errors.New("missing argument '--key'")
+	}
+
+	key, err := ezdeploy.LoadPrivateKey(optKey)
+	if err != nil {
+		return
+	}
+
+	var cfg ezdeploy.Config
+	if cfg, err = loadRootConfig(optConfig, optRoot); err != nil {
+		return
+	}
+
+	var ignore *ezdeploy.Ignore
+	if ignore, err = cfg.NewIgnore(); err != nil {
+		return
+	}
+
+	return ezdeploy.SignRoot(cfg.Root, ignore, key)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+const (
+	// exitCodeInterrupted exit code when interrupted by SIGINT or SIGTERM, same as shells do for SIGINT
+	exitCodeInterrupted = 130
+)
+
+var (
+	interrupted atomic.Bool
+)
+
+// withInterrupt returns a context cancelled on first SIGINT or SIGTERM, a second signal terminates immediately
+func withInterrupt(ctx context.Context, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-ch:
+			interrupted.Store(true)
+			logger.Warn("interrupted, stopping running commands and saving state, signal again to terminate immediately", "signal", sig.String())
+			// restore default behavior, so that a second signal terminates the process
+			signal.Stop(ch)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(ch)
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezblob"
+	"github.com/yankeguo/ezdeploy/pkg/ezkv"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	stateSubcommands = map[string]func(args []string) error{
+		"fsck": runStateFsck,
+		"list": runStateList,
+	}
+)
+
+// runState maintenance of the state
+func runState(args []string) error {
+	if len(args) > 0 {
+		if cmd, ok := stateSubcommands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+	}
+	var names []string
+	for name := range stateSubcommands {
+		names = append(names, name)
+	}
+	return errors.New("usage: ezdeploy state [" + strings.Join(names, "|") + "] [options]")
+}
+
+// stateOptions options shared by state subcommands, for locating the state
+type stateOptions struct {
+	config     string
+	root       string
+	kubeconfig string
+	overrides  configOverrides
+}
+
+func (o *stateOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", "", "path to config file, defaults to '"+ezdeploy.DefaultConfigFile+"' in root")
+	fs.StringVar(&o.root, "root", ".", "path to resource root")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "path to kubeconfig")
+	fs.StringVar(&o.overrides.StateNamespace, "state-namespace", ezdeploy.DefaultStateNamespace, "namespace of state")
+	fs.StringVar(&o.overrides.StateName, "state-name", ezdeploy.DefaultStateName, "name of state")
+	fs.StringVar(&o.overrides.StateStorage, "state-storage", ezdeploy.StateStorageSecret, "kind of objects storing state, 'secret' or 'configmap'")
+}
+
+// resolve load root config with overrides from parsed fs, and build a client, cleanUp must be invoked if err is nil
+func (o *stateOptions) resolve(fs *flag.FlagSet) (cfg ezdeploy.Config, client kubernetes.Interface, cleanUp func(), err error) {
+	if cfg, err = loadRootConfig(o.config, o.root); err != nil {
+		return
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "state-namespace":
+			cfg.State.Namespace = o.overrides.StateNamespace
+		case "state-name":
+			cfg.State.Name = o.overrides.StateName
+		case "state-storage":
+			cfg.State.Storage = o.overrides.StateStorage
+		}
+	})
+	if err = cfg.Validate(); err != nil {
+		return
+	}
+
+	var cs ezdeploy.KubernetesClientSource
+	if cs, err = ezdeploy.ResolveKubernetesClient(o.kubeconfig); err != nil {
+		return
+	}
+	if as := cfg.StateImpersonation(); as.IsZero() {
+		client, err = cs.Build()
+	} else {
+		client, err = cs.BuildAs(as)
+	}
+	if err != nil {
+		cs.CleanUp()
+		return
+	}
+	cleanUp = cs.CleanUp
+	return
+}
+
+// runStateFsck check integrity of the state and other blobs in state namespace, and delete orphaned chunks
+func runStateFsck(args []string) (err error) {
+	var (
+		optState stateOptions
+		optFsck  ezblob.FsckOptions
+	)
+
+	fs := flag.NewFlagSet("state fsck", flag.ExitOnError)
+	optState.register(fs)
+	fs.BoolVar(&optFsck.Delete, "delete", false, "delete orphaned revisions and chunks of blobs whose header is missing")
+	fs.DurationVar(&optFsck.MinAge, "min-age", ezblob.DefaultFsckMinAge, "orphaned chunks younger than this are never deleted, they may belong to a run in progress")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	cfg, client, cleanUp, err := optState.resolve(fs)
+	if err != nil {
+		return
+	}
+	defer cleanUp()
+
+	results, err := ezblob.FsckStorage(context.Background(), cfg.NewStateStorage(client), []string{cfg.State.Name}, optFsck)
+	if err != nil {
+		return
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	var problems int
+	for _, result := range results {
+		log := logger.With("blob", cfg.State.Namespace+"/"+result.Name)
+		switch {
+		case result.Err != nil:
+			problems++
+			log.Error("current revision is broken", "revision", result.Revision, ezlog.KeyError, result.Err.Error())
+		case result.HeaderMissing:
+			if len(result.Orphans) == 0 {
+				log.Info("blob not found")
+			} else {
+				log.Warn("header missing")
+			}
+		default:
+			log.Info("current revision is healthy", "revision", result.Revision, "chunks", result.Chunks)
+		}
+		if result.Previous != "" {
+			if result.PreviousErr != nil {
+				problems++
+				log.Warn("previous revision is broken, fallback is unavailable", "revision", result.Previous, ezlog.KeyError, result.PreviousErr.Error())
+			} else {
+				log.Info("previous revision is healthy", "revision", result.Previous)
+			}
+		}
+		for _, orphan := range result.Orphans {
+			switch {
+			case orphan.Deleted:
+				log.Info("orphaned revision deleted", "revision", orphan.Revision, "chunks", orphan.Chunks)
+			case orphan.Recent:
+				log.Info("recent revision kept, may belong to a run in progress", "revision", orphan.Revision, "chunks", orphan.Chunks)
+			default:
+				problems++
+				log.Warn("orphaned revision found, run with '--delete' to delete", "revision", orphan.Revision, "chunks", orphan.Chunks)
+			}
+		}
+	}
+
+	if problems > 0 {
+		err = errors.New("state fsck found problems")
+	}
+	return
+}
+
+// stateListItem a line printed by 'state list'
+type stateListItem struct {
+	ID string `json:"id"`
+	ezkv.Record
+}
+
+// runStateList print records of the state as JSON lines, sorted by id
+func runStateList(args []string) (err error) {
+	var (
+		optState  stateOptions
+		optPrefix string
+	)
+
+	fs := flag.NewFlagSet("state list", flag.ExitOnError)
+	optState.register(fs)
+	fs.StringVar(&optPrefix, "prefix", "", "only print records with id starting with prefix, e.g. 'default::'")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	cfg, client, cleanUp, err := optState.resolve(fs)
+	if err != nil {
+		return
+	}
+	defer cleanUp()
+
+	db, err := ezkv.Open(context.Background(), ezkv.Options{
+		Storage:   cfg.NewStateStorage(client),
+		Namespace: cfg.State.Namespace,
+		Name:      cfg.State.Name,
+	})
+	if err != nil {
+		return
+	}
+
+	var items []stateListItem
+	db.Range(func(key string, rec ezkv.Record) bool {
+		if strings.HasPrefix(key, optPrefix) {
+			items = append(items, stateListItem{ID: key, Record: rec})
+		}
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, item := range items {
+		if err = enc.Encode(item); err != nil {
+			return
+		}
+	}
+	return
+}
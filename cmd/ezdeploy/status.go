@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+	"k8s.io/client-go/kubernetes"
+)
+
+// publishStatus write status ConfigMap and Events of every namespace, failures are logged only
+func publishStatus(ctx context.Context, client kubernetes.Interface, logger *slog.Logger, report *ezdeploy.Report) {
+	for _, nr := range report.Namespaces {
+		if err := ezdeploy.PublishStatus(ctx, client, report, nr); err != nil {
+			logger.Warn("failed to publish status", ezlog.KeyNamespace, nr.Namespace, ezlog.KeyError, err.Error())
+		}
+		if err := ezdeploy.PublishEvents(ctx, client, report, nr); err != nil {
+			logger.Warn("failed to publish events", ezlog.KeyNamespace, nr.Namespace, ezlog.KeyError, err.Error())
+		}
+	}
+}
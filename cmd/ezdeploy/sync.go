@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezkv"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+	"github.com/yankeguo/rg"
+	"k8s.io/client-go/kubernetes"
+)
+
+type syncNamespaceOptions struct {
+	DB          *ezkv.KV
+	Client      kubernetes.Interface
+	Logger      *slog.Logger
+	Report      *ezdeploy.Report
+	Kubeconfig  string
+	Impersonate ezdeploy.Impersonation
+	Root        string
+	Namespace   string
+	LoadOptions ezdeploy.LoadOptions
+	DryRun      bool
+	Wait        bool
+	WaitTimeout time.Duration
+	Policy      ezdeploy.Policy
+	Guard       ezdeploy.NamespaceGuardConfig
+	Kinds       ezdeploy.ClusterScopedKinds
+	// ContinueOnError keep syncing remaining resources and releases after a failure, post-sync hooks are skipped
+	ContinueOnError bool
+}
+
+func syncNamespace(ctx context.Context, opts syncNamespaceOptions) (err error) {
+	logger := opts.Logger.With(ezlog.KeyNamespace, opts.Namespace)
+	report := opts.Report.Namespace(opts.Namespace)
+
+	startedAt := time.Now()
+	defer func() {
+		report.Finish(time.Since(startedAt), err)
+		if err == nil {
+			logger.Info("namespace synced", ezlog.KeyPhase, "sync", ezlog.KeyDuration, time.Since(startedAt))
+		} else {
+			logger.Error("namespace failed", ezlog.KeyPhase, "sync", ezlog.KeyDuration, time.Since(startedAt), ezlog.KeyError, err.Error())
+		}
+	}()
+
+	defer rg.Guard(&err)
+
+	logger.Info("scanning", ezlog.KeyPhase, "scan")
+
+	res := rg.Must(ezdeploy.Load(opts.Root, opts.Namespace, opts.LoadOptions))
+
+	registerSecrets(res)
+
+	// template of records written for applied items
+	record := ezkv.Record{
+		RunID:     opts.Report.RunID,
+		Version:   opts.Report.Version,
+		GitCommit: opts.Report.GitCommit,
+		Owner:     opts.Impersonate.User,
+	}
+
+	// checksums recorded by previous versions are upgraded in place if content is unchanged
+	if migrated := ezdeploy.MigrateChecksums(opts.DB, res); migrated > 0 {
+		logger.Info("checksums migrated", ezlog.KeyPhase, "state", "count", migrated)
+	}
+
+	// policy checks before anything is applied
+	rg.Must0(checkNamespaceGuard(logger, report, opts.Guard, opts.Kinds, opts.Namespace, concatResources(res)))
+	rg.Must0(checkPolicy(logger, report, opts.Policy, concatResources(res)))
+
+	// hooks only run when something in the namespace is about to change
+	changed := hasChanges(opts.DB, res)
+
+	if changed {
+		rg.Must0(runHooks(ctx, runHooksOptions{
+			DB:          opts.DB,
+			Record:      record,
+			Client:      opts.Client,
+			Logger:      logger,
+			Report:      report,
+			Hooks:       res.PreSyncHooks,
+			Namespace:   opts.Namespace,
+			Kubeconfig:  opts.Kubeconfig,
+			Impersonate: opts.Impersonate,
+			DryRun:      opts.DryRun,
+			Timeout:     opts.WaitTimeout,
+		}))
+	}
+
+	var errs []error
+
+	check := func(err error) {
+		if err == nil {
+			return
+		}
+		// nothing more can be done once the run is cancelled
+		if !opts.ContinueOnError || ctx.Err() != nil {
+			panic(err)
+		}
+		errs = append(errs, err)
+	}
+
+	// all rollouts in a namespace share the same deadline
+	var waitDeadline time.Time
+	if opts.Wait {
+		waitDeadline = time.Now().Add(opts.WaitTimeout)
+	}
+
+	check(syncResources(ctx, syncResourcesOptions{
+		DB:           opts.DB,
+		Record:       record,
+		Client:       opts.Client,
+		Logger:       logger,
+		Report:       report,
+		Resources:    res.Resources,
+		Namespace:    opts.Namespace,
+		Kubeconfig:   opts.Kubeconfig,
+		Impersonate:  opts.Impersonate,
+		DryRun:       opts.DryRun,
+		Wait:         opts.Wait,
+		WaitDeadline: waitDeadline,
+	}))
+
+	check(syncResources(ctx, syncResourcesOptions{
+		DB:           opts.DB,
+		Record:       record,
+		Client:       opts.Client,
+		Logger:       logger,
+		Report:       report,
+		Resources:    res.ResourcesExt,
+		Namespace:    "",
+		Kubeconfig:   opts.Kubeconfig,
+		Impersonate:  opts.Impersonate,
+		DryRun:       opts.DryRun,
+		Wait:         opts.Wait,
+		WaitDeadline: waitDeadline,
+	}))
+
+	for _, release := range res.Releases {
+		check(syncRelease(ctx, syncReleaseOptions{
+			DB:          opts.DB,
+			Record:      record,
+			Logger:      logger.With(ezlog.KeyRelease, release.Name),
+			Report:      report,
+			Release:     release,
+			Policy:      opts.Policy,
+			Guard:       opts.Guard,
+			Kinds:       opts.Kinds,
+			ExtVars:     opts.LoadOptions.ExtVars,
+			Namespace:   opts.Namespace,
+			Kubeconfig:  opts.Kubeconfig,
+			Impersonate: opts.Impersonate,
+			DryRun:      opts.DryRun,
+		}))
+	}
+
+	if len(errs) > 0 {
+		if changed && len(res.PostSyncHooks) > 0 {
+			logger.Warn("post-sync hooks skipped due to previous failure", ezlog.KeyPhase, "hook")
+		}
+		err = errors.Join(errs...)
+		return
+	}
+
+	if changed {
+		rg.Must0(runHooks(ctx, runHooksOptions{
+			DB:          opts.DB,
+			Record:      record,
+			Client:      opts.Client,
+			Logger:      logger,
+			Report:      report,
+			Hooks:       res.PostSyncHooks,
+			Namespace:   opts.Namespace,
+			Kubeconfig:  opts.Kubeconfig,
+			Impersonate: opts.Impersonate,
+			DryRun:      opts.DryRun,
+			Timeout:     opts.WaitTimeout,
+		}))
+	}
+
+	return
+}
+
+// concatResources returns all resources and hooks
+func concatResources(res ezdeploy.LoadResult) []ezdeploy.Resource {
+	out := append(append([]ezdeploy.Resource{}, res.Resources...), res.ResourcesExt...)
+	for _, items := range [][]ezdeploy.Hook{res.PreSyncHooks, res.PostSyncHooks} {
+		for _, item := range items {
+			out = append(out, item.Resource)
+		}
+	}
+	return out
+}
+
+func hasChanges(db *ezkv.KV, res ezdeploy.LoadResult) bool {
+	for _, items := range [][]ezdeploy.Resource{res.Resources, res.ResourcesExt} {
+		for _, item := range items {
+			if db.Checksum(item.ID) != item.Checksum {
+				return true
+			}
+		}
+	}
+	for _, items := range [][]ezdeploy.Hook{res.PreSyncHooks, res.PostSyncHooks} {
+		for _, item := range items {
+			if db.Checksum(item.ID) != item.Checksum {
+				return true
+			}
+		}
+	}
+	for _, release := range res.Releases {
+		if db.Checksum(release.ID) != release.Checksum {
+			return true
+		}
+	}
+	return false
+}
+
+type syncResourcesOptions struct {
+	DB           *ezkv.KV
+	Record       ezkv.Record
+	Client       kubernetes.Interface
+	Logger       *slog.Logger
+	Report       *ezdeploy.NamespaceReport
+	Resources    []ezdeploy.Resource
+	Namespace    string
+	Kubeconfig   string
+	Impersonate  ezdeploy.Impersonation
+	DryRun       bool
+	Wait         bool
+	WaitDeadline time.Time
+}
+
+func syncResources(ctx context.Context, opts syncResourcesOptions) (err error) {
+	defer rg.Guard(&err)
+
+	var resources []ezdeploy.Resource
+
+	for _, res := range opts.Resources {
+		if opts.DB.Checksum(res.ID) == res.Checksum {
+			opts.Logger.Debug("resource unchanged", ezlog.KeyResource, res.ID)
+			opts.Report.Add(ezdeploy.ReportItem{
+				ID:             res.ID,
+				Kind:           ezdeploy.ReportKindResource,
+				Object:         reportObject(res),
+				Path:           res.Path,
+				Outcome:        ezdeploy.OutcomeSkipped,
+				ChecksumBefore: res.Checksum,
+				ChecksumAfter:  res.Checksum,
+			})
+			continue
+		}
+		resources = append(resources, res)
+	}
+
+	if len(resources) == 0 {
+		return
+	}
+
+	var raws []json.RawMessage
+	for _, res := range resources {
+		raws = append(raws, res.Raw)
+	}
+
+	buf := rg.Must(json.Marshal(ezdeploy.NewList(raws)))
+
+	args := []string{"apply", "-f", "-"}
+
+	if opts.Namespace != "" {
+		args = append(args, "-n", opts.Namespace)
+	}
+
+	if opts.DryRun {
+		args = append(args, "--dry-run=server")
+	}
+
+	startedAt := time.Now()
+
+	report := func(res ezdeploy.Resource, duration time.Duration, err error) {
+		item := ezdeploy.ReportItem{
+			ID:             res.ID,
+			Kind:           ezdeploy.ReportKindResource,
+			Object:         reportObject(res),
+			Path:           res.Path,
+			Outcome:        ezdeploy.OutcomeApplied,
+			ChecksumBefore: opts.DB.Checksum(res.ID),
+			ChecksumAfter:  res.Checksum,
+			Duration:       duration.Seconds(),
+		}
+		if err != nil {
+			item.Outcome = ezdeploy.OutcomeFailed
+			item.Error = err.Error()
+		}
+		opts.Report.Add(item)
+	}
+
+	if err = runCommand(ctx, runCommandOptions{
+		Logger:      opts.Logger.With(ezlog.KeyPhase, "apply"),
+		Name:        "kubectl",
+		Args:        args,
+		Stdin:       buf,
+		Kubeconfig:  opts.Kubeconfig,
+		Impersonate: opts.Impersonate,
+	}); err != nil {
+		for _, res := range resources {
+			report(res, time.Since(startedAt), err)
+		}
+		return
+	}
+
+	applyDuration := time.Since(startedAt)
+
+	if opts.DryRun {
+		for _, res := range resources {
+			report(res, applyDuration, nil)
+		}
+		opts.Logger.Info("resources synced (dry run)", ezlog.KeyPhase, "apply", ezlog.KeyDuration, applyDuration)
+		return
+	}
+
+	// wait for rollouts, failed workloads are not recorded, thus will be applied again next time
+	var failed []error
+
+	for _, res := range resources {
+		if opts.Wait && ezdeploy.IsRolloutKind(res.Object) {
+			waitStartedAt := time.Now()
+			if err := waitForRollout(ctx, opts, res); err != nil {
+				opts.Logger.Error("rollout failed", ezlog.KeyPhase, "wait", ezlog.KeyResource, res.ID, ezlog.KeyError, err.Error())
+				report(res, applyDuration+time.Since(waitStartedAt), err)
+				failed = append(failed, err)
+				continue
+			}
+			report(res, applyDuration+time.Since(waitStartedAt), nil)
+		} else {
+			report(res, applyDuration, nil)
+		}
+		opts.DB.Put(res.ID, newRecord(opts.Record, ezkv.ModeApply, res.Checksum, res.Path))
+		opts.Logger.Debug("resource applied", ezlog.KeyPhase, "apply", ezlog.KeyResource, res.ID)
+	}
+
+	if len(failed) > 0 {
+		err = errors.Join(failed...)
+		return
+	}
+
+	opts.Logger.Info("resources synced", ezlog.KeyPhase, "apply", ezlog.KeyDuration, time.Since(startedAt))
+
+	return
+}
+
+// newRecord returns a record of an item applied just now, based on template
+func newRecord(template ezkv.Record, mode string, checksum string, path string) ezkv.Record {
+	rec := template
+	rec.Mode, rec.Checksum, rec.Path, rec.AppliedAt = mode, checksum, path, time.Now()
+	return rec
+}
+
+// reportObject returns object of resource with effective namespace
+func reportObject(res ezdeploy.Resource) *ezdeploy.Object {
+	obj := res.Object
+	if obj.Metadata.Namespace == "" {
+		obj.Metadata.Namespace = res.Namespace
+	}
+	return &obj
+}
+
+func waitForRollout(ctx context.Context, opts syncResourcesOptions, res ezdeploy.Resource) error {
+	ctx, cancel := context.WithDeadline(ctx, opts.WaitDeadline)
+	defer cancel()
+
+	startedAt := time.Now()
+
+	opts.Logger.Info("waiting for rollout", ezlog.KeyPhase, "wait", ezlog.KeyResource, res.ID)
+
+	if err := ezdeploy.WaitForRollout(ctx, opts.Client, res.Namespace, res.Object, ezdeploy.DefaultRolloutInterval); err != nil {
+		return err
+	}
+
+	opts.Logger.Info("rollout completed", ezlog.KeyPhase, "wait", ezlog.KeyResource, res.ID, ezlog.KeyDuration, time.Since(startedAt))
+	return nil
+}
+
+type syncReleaseOptions struct {
+	DB          *ezkv.KV
+	Record      ezkv.Record
+	Logger      *slog.Logger
+	Report      *ezdeploy.NamespaceReport
+	Release     ezdeploy.Release
+	Policy      ezdeploy.Policy
+	Guard       ezdeploy.NamespaceGuardConfig
+	Kinds       ezdeploy.ClusterScopedKinds
+	ExtVars     map[string]string
+	Namespace   string
+	Kubeconfig  string
+	Impersonate ezdeploy.Impersonation
+	DryRun      bool
+}
+
+func syncRelease(ctx context.Context, opts syncReleaseOptions) (err error) {
+	item := ezdeploy.ReportItem{
+		ID:             opts.Release.ID,
+		Kind:           ezdeploy.ReportKindRelease,
+		Path:           opts.Release.ValuesFile,
+		Outcome:        ezdeploy.OutcomeApplied,
+		ChecksumBefore: opts.DB.Checksum(opts.Release.ID),
+		ChecksumAfter:  opts.Release.Checksum,
+	}
+
+	startedAt := time.Now()
+	defer func() {
+		item.Duration = time.Since(startedAt).Seconds()
+		if err != nil {
+			item.Outcome = ezdeploy.OutcomeFailed
+			item.Error = err.Error()
+		}
+		opts.Report.Add(item)
+	}()
+
+	defer rg.Guard(&err)
+
+	if item.ChecksumBefore == opts.Release.Checksum {
+		opts.Logger.Debug("release unchanged")
+		item.Outcome = ezdeploy.OutcomeSkipped
+		return
+	}
+
+	valuesFile := opts.Release.ValuesFile
+
+	// convert jsonnet file to yaml file
+	if opts.Release.ValuesType == ezdeploy.FileTypeHelmJSONNet {
+		if valuesFile, err = ezdeploy.ConvertJSONNetFileToYAML(valuesFile, opts.Namespace, opts.ExtVars); err != nil {
+			return
+		}
+	}
+
+	_ = redactor.AddValuesFile(valuesFile)
+
+	if opts.Policy.Enabled() || opts.Guard.Enabled() {
+		rg.Must0(checkRelease(opts, rg.Must(renderRelease(ctx, opts, valuesFile))))
+	}
+
+	args := []string{
+		"upgrade", "--install",
+		"--namespace", opts.Namespace,
+		opts.Release.Name, opts.Release.Chart.Path,
+		"-f", valuesFile,
+	}
+
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+
+	// output may contain rendered manifests and notes, it is held back until secrets of the release are registered
+	out := &bytes.Buffer{}
+	err = runCommand(ctx, runCommandOptions{
+		Logger:      opts.Logger.With(ezlog.KeyPhase, "release"),
+		Name:        "helm",
+		Args:        args,
+		Stdout:      out,
+		Kubeconfig:  opts.Kubeconfig,
+		Impersonate: opts.Impersonate,
+	})
+	registerReleaseSecrets(ctx, opts, out.Bytes())
+	stdout := ezlog.NewEventWriter(opts.Logger.With(ezlog.KeyPhase, "release"), "command output", ezlog.KeyCommand, "helm", ezlog.KeyStream, "stdout")
+	_, _ = stdout.Write(out.Bytes())
+	_ = stdout.Close()
+	rg.Must0(err)
+
+	if !opts.DryRun {
+		opts.DB.Put(opts.Release.ID, newRecord(opts.Record, ezkv.ModeRelease, opts.Release.Checksum, opts.Release.ValuesFile))
+	}
+
+	if opts.DryRun {
+		opts.Logger.Info("release synced (dry run)", ezlog.KeyPhase, "release", ezlog.KeyDuration, time.Since(startedAt))
+	} else {
+		opts.Logger.Info("release synced", ezlog.KeyPhase, "release", ezlog.KeyDuration, time.Since(startedAt))
+	}
+
+	return
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/yankeguo/ezdeploy"
+	"github.com/yankeguo/ezdeploy/pkg/ezlog"
+	"github.com/yankeguo/ezdeploy/pkg/ezsync"
+)
+
+// notifyWebhooks send summary of the report to all webhooks concurrently, failures are logged only
+func notifyWebhooks(ctx context.Context, logger *slog.Logger, webhooks []ezdeploy.WebhookConfig, report *ezdeploy.Report) {
+	if len(webhooks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*2)
+	defer cancel()
+
+	summary := ezdeploy.NewSummary(report)
+
+	_ = ezsync.DoPara(ctx, webhooks, len(webhooks), func(ctx context.Context, w ezdeploy.WebhookConfig) (err error) {
+		if !w.ShouldFire(summary) {
+			return
+		}
+		if err = ezdeploy.SendWebhook(ctx, w, summary); err != nil {
+			logger.Warn("failed to send webhook", ezlog.KeyPhase, "notify", ezlog.KeyError, err.Error())
+		}
+		return
+	})
+}
@@ -8,8 +8,9 @@ import (
 	"strings"
 )
 
-func collectReleases(root string, namespace string, charts map[string]Chart) (releases []Release, err error) {
+func collectReleases(root string, namespace string, opts LoadOptions) (releases []Release, err error) {
 	dir := filepath.Join(root, namespace)
+	fileTypes := opts.fileTypes()
 
 	var entries []fs.DirEntry
 	if entries, err = os.ReadDir(dir); err != nil {
@@ -19,7 +20,15 @@ func collectReleases(root string, namespace string, charts map[string]Chart) (re
 		if entry.IsDir() {
 			continue
 		}
-		if !SuffixesHelmValues.Match(entry.Name()) {
+		var ignored bool
+		if ignored, err = opts.Ignore.ignored(filepath.Join(dir, entry.Name()), false); err != nil {
+			return
+		}
+		if ignored {
+			continue
+		}
+		valuesType := fileTypes.Match(entry.Name())
+		if !IsHelmFileType(valuesType) {
 			continue
 		}
 		splits := strings.SplitN(entry.Name(), ".", 3)
@@ -27,7 +36,7 @@ func collectReleases(root string, namespace string, charts map[string]Chart) (re
 			continue
 		}
 		name, chartName := splits[0], splits[1]
-		chart, ok := charts[chartName]
+		chart, ok := opts.Charts[chartName]
 		if !ok {
 			err = errors.New("missing chart named '" + chartName + "'")
 			return
@@ -37,13 +46,15 @@ func collectReleases(root string, namespace string, charts map[string]Chart) (re
 			Name:       name,
 			Chart:      chart,
 			ValuesFile: filepath.Join(dir, entry.Name()),
+			ValuesType: valuesType,
 		}
 
-		var checksum string
-		if checksum, err = checksumFile(release.ValuesFile); err != nil {
+		var checksum, legacy string
+		if checksum, legacy, err = checksumFile(release.ValuesFile); err != nil {
 			return
 		}
 		release.Checksum = checksumBytes([]byte(chart.Checksum + checksum))
+		release.LegacyChecksum = legacyChecksumBytes([]byte(chart.LegacyChecksum + legacy))
 
 		releases = append(releases, release)
 	}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"os"
 
-	"github.com/google/go-jsonnet"
 	"gopkg.in/yaml.v3"
 )
 
@@ -50,22 +49,22 @@ func sanitizeRawResources(raws *[]json.RawMessage) (err error) {
 	return
 }
 
-func collectResourceFile(file string, namespace string) (raws []json.RawMessage, err error) {
-	if SuffixesHelmValues.Match(file) {
-		// ignore helm
-	} else if SuffixesYAML.Match(file) {
+func collectResourceFile(file string, namespace string, opts LoadOptions) (raws []json.RawMessage, err error) {
+	switch opts.fileTypes().Match(file) {
+	case FileTypeYAML:
 		if err = collectYAMLFile(&raws, file); err != nil {
 			return
 		}
-	} else if SuffixesJSON.Match(file) {
+	case FileTypeJSON:
 		if err = collectJSONFile(&raws, file); err != nil {
 			return
 		}
-	} else if SuffixesJSONNet.Match(file) {
-		if err = collectJSONNetFile(&raws, file, namespace); err != nil {
+	case FileTypeJSONNet:
+		if err = collectJSONNetFile(&raws, file, namespace, opts.ExtVars); err != nil {
 			return
 		}
-	} else {
+	default:
+		// ignore helm values and unknown files
 		return
 	}
 
@@ -100,6 +99,30 @@ func collectYAMLFile(out *[]json.RawMessage, file string) (err error) {
 	return
 }
 
+// collectYAMLContent like collectYAMLFile, but empty documents are skipped
+func collectYAMLContent(out *[]json.RawMessage, raw []byte) (err error) {
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc map[string]interface{}
+		var buf []byte
+		if err = dec.Decode(&doc); err == nil {
+			if doc == nil {
+				continue
+			}
+			if buf, err = json.Marshal(doc); err != nil {
+				return
+			}
+			*out = append(*out, buf)
+		} else {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
 func collectJSONContent(out *[]json.RawMessage, raw []byte) (err error) {
 	raw = bytes.TrimSpace(raw)
 	if len(raw) < 2 {
@@ -134,9 +157,8 @@ func collectJSONFile(out *[]json.RawMessage, file string) (err error) {
 	return
 }
 
-func collectJSONNetFile(out *[]json.RawMessage, file string, namespace string) (err error) {
-	vm := jsonnet.MakeVM()
-	vm.ExtVar("NAMESPACE", namespace)
+func collectJSONNetFile(out *[]json.RawMessage, file string, namespace string, extVars map[string]string) (err error) {
+	vm := newJSONNetVM(namespace, extVars)
 	var raw string
 	if raw, err = vm.EvaluateFile(file); err != nil {
 		return
@@ -0,0 +1,248 @@
+package ezdeploy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yankeguo/ezdeploy/pkg/ezblob"
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultConfigFile     = "ezdeploy.yaml"
+	DefaultConcurrency    = 5
+	DefaultStateNamespace = "default"
+	DefaultStateName      = "ezdeploy"
+
+	OnErrorContinue = "continue"
+	OnErrorFailFast = "fail-fast"
+
+	StateStorageSecret    = "secret"
+	StateStorageConfigMap = "configmap"
+)
+
+// StateConfig location of the ezkv state
+type StateConfig struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// Storage kind of objects storing the state, 'secret' or 'configmap'
+	Storage string `yaml:"storage"`
+	// Impersonate identity impersonated when loading and saving the state, defaults to the '*' entry of
+	// 'impersonate', an empty identity uses the original one
+	Impersonate *Impersonation `yaml:"impersonate"`
+}
+
+// Config project configuration, usually loaded from 'ezdeploy.yaml'
+type Config struct {
+	// Root resource root, relative to the directory of configuration file
+	Root string `yaml:"root"`
+	// Concurrency maximum number of namespaces synced concurrently
+	Concurrency int `yaml:"concurrency"`
+	// OnError error policy, 'continue' finishes everything and reports, 'fail-fast' stops the whole run on first error
+	OnError string `yaml:"onError"`
+	// State location of the state
+	State StateConfig `yaml:"state"`
+	// Charts directories containing Helm charts, relative to root
+	Charts []string `yaml:"charts"`
+	// FileTypes additional mapping from file suffix to file type
+	FileTypes FileTypes `yaml:"fileTypes"`
+	// ExtVars default jsonnet external variables
+	ExtVars map[string]string `yaml:"extVars"`
+	// Ignore gitignore style patterns of ignored paths, relative to root
+	Ignore []string `yaml:"ignore"`
+	// Generators options of ConfigMap and Secret generators
+	Generators GeneratorConfig `yaml:"generators"`
+	// Policy policy checks of resources before applied
+	Policy PolicyConfig `yaml:"policy"`
+	// NamespaceGuard guard against objects escaping their namespace directory
+	NamespaceGuard NamespaceGuardConfig `yaml:"namespaceGuard"`
+	// Impersonate identity impersonated by namespace directory, '*' for all other namespaces
+	Impersonate map[string]Impersonation `yaml:"impersonate"`
+	// RedactKeys additional regular expressions of sensitive keys, values under them are redacted from output
+	RedactKeys []string `yaml:"redactKeys"`
+	// Webhooks outbound webhooks notified with a summary of each run
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+// DefaultConfig returns a Config with all default values
+func DefaultConfig() Config {
+	return Config{
+		Root:        ".",
+		Concurrency: DefaultConcurrency,
+		OnError:     OnErrorContinue,
+		State: StateConfig{
+			Namespace: DefaultStateNamespace,
+			Name:      DefaultStateName,
+			Storage:   StateStorageSecret,
+		},
+		Charts: []string{SubdirHelm},
+	}
+}
+
+// LoadConfig load configuration file, unknown keys are rejected, missing values are defaulted,
+// and root is resolved against the directory of file
+func LoadConfig(file string) (cfg Config, err error) {
+	cfg = DefaultConfig()
+
+	var buf []byte
+	if buf, err = os.ReadFile(file); err != nil {
+		return
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err = dec.Decode(&cfg); err != nil {
+		if err == io.EOF {
+			err = nil
+		} else {
+			err = errors.New("invalid config file " + file + ": " + err.Error())
+			return
+		}
+	}
+
+	if !filepath.IsAbs(cfg.Root) {
+		cfg.Root = filepath.Join(filepath.Dir(file), cfg.Root)
+	}
+
+	if err = cfg.Validate(); err != nil {
+		err = errors.New("invalid config file " + file + ": " + err.Error())
+		return
+	}
+	return
+}
+
+// Validate check all fields
+func (cfg Config) Validate() error {
+	if cfg.Root == "" {
+		return errors.New("'root' must not be empty")
+	}
+	if cfg.Concurrency < 1 {
+		return errors.New("'concurrency' must be greater than 0")
+	}
+	switch cfg.OnError {
+	case OnErrorContinue, OnErrorFailFast:
+	default:
+		return errors.New("'onError' must be '" + OnErrorContinue + "' or '" + OnErrorFailFast + "'")
+	}
+	if cfg.State.Namespace == "" {
+		return errors.New("'state.namespace' must not be empty")
+	}
+	if cfg.State.Name == "" {
+		return errors.New("'state.name' must not be empty")
+	}
+	switch cfg.State.Storage {
+	case StateStorageSecret, StateStorageConfigMap:
+	default:
+		return errors.New("'state.storage' must be '" + StateStorageSecret + "' or '" + StateStorageConfigMap + "'")
+	}
+	if cfg.State.Impersonate != nil {
+		if err := cfg.State.Impersonate.Validate(); err != nil {
+			return errors.New("'state.impersonate': " + err.Error())
+		}
+	}
+	if len(cfg.Charts) == 0 {
+		return errors.New("'charts' must not be empty")
+	}
+	for _, dir := range cfg.Charts {
+		if dir == "" || filepath.IsAbs(dir) || strings.HasPrefix(filepath.Clean(dir), "..") {
+			return errors.New("'charts' must be relative paths inside root: '" + dir + "'")
+		}
+	}
+	if err := cfg.FileTypes.Validate(); err != nil {
+		return errors.New("'fileTypes': " + err.Error())
+	}
+	if _, err := parseIgnoreRules("", cfg.Ignore); err != nil {
+		return errors.New("'ignore': " + err.Error())
+	}
+	if err := cfg.Policy.Validate(); err != nil {
+		return errors.New("'policy': " + err.Error())
+	}
+	if err := cfg.NamespaceGuard.Validate(); err != nil {
+		return errors.New("'namespaceGuard': " + err.Error())
+	}
+	for ns, i := range cfg.Impersonate {
+		if err := i.Validate(); err != nil {
+			return errors.New("'impersonate." + ns + "': " + err.Error())
+		}
+	}
+	if _, err := NewRedactor(cfg.RedactKeys); err != nil {
+		return errors.New("'redactKeys': " + err.Error())
+	}
+	for i, w := range cfg.Webhooks {
+		if err := w.Validate(); err != nil {
+			return errors.New("'webhooks[" + strconv.Itoa(i) + "]': " + err.Error())
+		}
+	}
+	for k := range cfg.ExtVars {
+		if k == "NAMESPACE" {
+			return errors.New("'extVars': 'NAMESPACE' is reserved")
+		}
+	}
+	return nil
+}
+
+// FailFast returns whether the run stops on first error
+func (cfg Config) FailFast() bool {
+	return cfg.OnError == OnErrorFailFast
+}
+
+// ImpersonationFor returns the resolved identity impersonated when syncing namespace, zero if none
+func (cfg Config) ImpersonationFor(namespace string) Impersonation {
+	i, ok := cfg.Impersonate[namespace]
+	if !ok {
+		i = cfg.Impersonate[ImpersonateDefault]
+	}
+	return i.Resolve(namespace)
+}
+
+// StateImpersonation returns the resolved identity impersonated for the state, zero if none; the state is shared
+// by all namespaces, thus 'state.impersonate' or the '*' entry of 'impersonate' is used
+func (cfg Config) StateImpersonation() Impersonation {
+	if cfg.State.Impersonate != nil {
+		return cfg.State.Impersonate.Resolve(cfg.State.Namespace)
+	}
+	return cfg.Impersonate[ImpersonateDefault].Resolve(cfg.State.Namespace)
+}
+
+// NewRedactor create a Redactor with configured sensitive keys
+func (cfg Config) NewRedactor() (*Redactor, error) {
+	return NewRedactor(cfg.RedactKeys)
+}
+
+// NewStateStorage create the ezblob storage of state
+func (cfg Config) NewStateStorage(client kubernetes.Interface) ezblob.Storage {
+	if cfg.State.Storage == StateStorageConfigMap {
+		return ezblob.NewConfigMapStorage(client, cfg.State.Namespace)
+	}
+	return ezblob.NewSecretStorage(client, cfg.State.Namespace)
+}
+
+// NewIgnore create an Ignore for root with configured patterns
+func (cfg Config) NewIgnore() (*Ignore, error) {
+	return NewIgnore(cfg.Root, cfg.Ignore)
+}
+
+// ScanOptions returns options for Scan
+func (cfg Config) ScanOptions(ignore *Ignore) ScanOptions {
+	return ScanOptions{
+		ChartDirs: cfg.Charts,
+		Ignore:    ignore,
+	}
+}
+
+// LoadOptions returns options for Load
+func (cfg Config) LoadOptions(charts map[string]Chart, ignore *Ignore) LoadOptions {
+	return LoadOptions{
+		Charts:     charts,
+		FileTypes:  DefaultFileTypes().Merge(cfg.FileTypes),
+		ExtVars:    cfg.ExtVars,
+		Ignore:     ignore,
+		Generators: cfg.Generators,
+	}
+}
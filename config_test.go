@@ -0,0 +1,60 @@
+package ezdeploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join("testdata", "root", DefaultConfigFile))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("testdata", "root"), cfg.Root)
+	require.Equal(t, 3, cfg.Concurrency)
+	require.True(t, cfg.FailFast())
+	require.Equal(t, "ops", cfg.State.Namespace)
+	require.Equal(t, DefaultStateName, cfg.State.Name)
+	require.Equal(t, "demo", cfg.ExtVars["CLUSTER"])
+	require.Equal(t, FileTypeIgnore, cfg.LoadOptions(nil, nil).FileTypes.Match("a.tpl.yaml"))
+	require.Equal(t, FileTypeYAML, cfg.LoadOptions(nil, nil).FileTypes.Match("a.yaml"))
+
+	file := filepath.Join(t.TempDir(), DefaultConfigFile)
+	err = os.WriteFile(file, []byte("concurrency: 3\nconcurency: 4\n"), 0640)
+	require.NoError(t, err)
+	_, err = LoadConfig(file)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "concurency")
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Concurrency = 0
+	require.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.ExtVars = map[string]string{"NAMESPACE": "a"}
+	require.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.Charts = []string{"../charts"}
+	require.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	require.False(t, cfg.FailFast())
+	cfg.OnError = "abort"
+	require.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.State.Storage = "etcd"
+	require.Error(t, cfg.Validate())
+	cfg.State.Storage = StateStorageConfigMap
+	require.NoError(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.RedactKeys = []string{"(?i)secret["}
+	require.Error(t, cfg.Validate())
+}
@@ -0,0 +1,80 @@
+package ezdeploy
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	FileTypeYAML        = "yaml"
+	FileTypeJSON        = "json"
+	FileTypeJSONNet     = "jsonnet"
+	FileTypeHelm        = "helm"
+	FileTypeHelmJSONNet = "helm-jsonnet"
+	FileTypeIgnore      = "ignore"
+)
+
+// FileTypes mapping from file suffix to file type
+type FileTypes map[string]string
+
+// DefaultFileTypes returns the builtin file type mapping
+func DefaultFileTypes() FileTypes {
+	ft := FileTypes{}
+	for _, s := range SuffixesYAML {
+		ft[s] = FileTypeYAML
+	}
+	for _, s := range SuffixesJSON {
+		ft[s] = FileTypeJSON
+	}
+	for _, s := range SuffixesJSONNet {
+		ft[s] = FileTypeJSONNet
+	}
+	for _, s := range SuffixesHelmValues {
+		ft[s] = FileTypeHelm
+	}
+	ft[SuffixHelmValuesJSONNet] = FileTypeHelmJSONNet
+	return ft
+}
+
+// Merge returns a new mapping with entries of other overriding the current ones
+func (ft FileTypes) Merge(other FileTypes) FileTypes {
+	out := FileTypes{}
+	for k, v := range ft {
+		out[k] = v
+	}
+	for k, v := range other {
+		out[k] = v
+	}
+	return out
+}
+
+// Validate check suffixes and types
+func (ft FileTypes) Validate() error {
+	for suffix, typ := range ft {
+		if !strings.HasPrefix(suffix, ".") {
+			return errors.New("file type suffix must start with '.': '" + suffix + "'")
+		}
+		switch typ {
+		case FileTypeYAML, FileTypeJSON, FileTypeJSONNet, FileTypeHelm, FileTypeHelmJSONNet, FileTypeIgnore:
+		default:
+			return errors.New("invalid file type for suffix '" + suffix + "': '" + typ + "'")
+		}
+	}
+	return nil
+}
+
+// Match returns the type of the longest matching suffix, or empty string if nothing matches
+func (ft FileTypes) Match(path string) (typ string) {
+	var suffix string
+	for s, t := range ft {
+		if len(s) > len(suffix) && strings.HasSuffix(path, s) {
+			suffix, typ = s, t
+		}
+	}
+	return
+}
+
+// IsHelmFileType returns whether the type is a Helm values file
+func IsHelmFileType(typ string) bool {
+	return typ == FileTypeHelm || typ == FileTypeHelmJSONNet
+}
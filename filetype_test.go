@@ -0,0 +1,19 @@
+package ezdeploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTypes(t *testing.T) {
+	ft := DefaultFileTypes()
+	require.Equal(t, FileTypeYAML, ft.Match("a.yaml"))
+	require.Equal(t, FileTypeHelm, ft.Match("a.b.helm.yaml"))
+	require.Equal(t, FileTypeHelmJSONNet, ft.Match("a.b.helm.jsonnet"))
+	require.Equal(t, "", ft.Match("a.txt"))
+
+	require.NoError(t, ft.Validate())
+	require.Error(t, FileTypes{"txt": FileTypeYAML}.Validate())
+	require.Error(t, FileTypes{".txt": "text"}.Validate())
+}
@@ -0,0 +1,316 @@
+package ezdeploy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	SuffixConfigMapDir = ".configmap.d"
+	SuffixConfigMapEnv = ".configmap.env"
+	SuffixSecretDir    = ".secret.d"
+	SuffixSecretEnv    = ".secret.env"
+
+	generatorHashLength = 10
+)
+
+var (
+	generatorKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+// GeneratorConfig options of ConfigMap and Secret generators
+type GeneratorConfig struct {
+	// HashSuffix append a hash of content to names of generated objects, references in workloads of the same
+	// namespace are rewritten, so pods are rolled when content changes. Objects of previous names are never deleted,
+	// each change of content leaves one more object behind, remove them manually. Without it, generated objects keep
+	// their names, and workloads are not rolled when content changes
+	HashSuffix bool `yaml:"hashSuffix"`
+}
+
+// generatorKind returns kind and name of the generator at path, empty kind if it's not a generator
+func generatorKind(file string, isDir bool) (kind string, name string) {
+	base := filepath.Base(file)
+	for _, item := range []struct {
+		suffix string
+		kind   string
+		dir    bool
+	}{
+		{SuffixConfigMapDir, "ConfigMap", true},
+		{SuffixConfigMapEnv, "ConfigMap", false},
+		{SuffixSecretDir, "Secret", true},
+		{SuffixSecretEnv, "Secret", false},
+	} {
+		if item.dir == isDir && strings.HasSuffix(base, item.suffix) {
+			if name = strings.TrimSuffix(base, item.suffix); name != "" {
+				kind = item.kind
+			}
+			return
+		}
+	}
+	return
+}
+
+// readGeneratorDir read regular files of a generator directory as key-value pairs, subdirectories are skipped
+func readGeneratorDir(dir string, ignore *Ignore) (data map[string][]byte, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(dir); err != nil {
+		return
+	}
+	data = map[string][]byte{}
+	for _, entry := range entries {
+		file := filepath.Join(dir, entry.Name())
+		var ignored bool
+		if ignored, err = ignore.ignored(file, entry.IsDir()); err != nil {
+			return
+		}
+		if ignored || entry.IsDir() {
+			continue
+		}
+		if !generatorKeyPattern.MatchString(entry.Name()) {
+			err = errors.New("invalid key '" + entry.Name() + "' in generator " + dir)
+			return
+		}
+		if data[entry.Name()], err = os.ReadFile(file); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readGeneratorEnv read a 'KEY=VALUE' file as key-value pairs, empty lines and lines starting with '#' are skipped,
+// values can be quoted
+func readGeneratorEnv(file string) (data map[string][]byte, err error) {
+	var buf []byte
+	if buf, err = os.ReadFile(file); err != nil {
+		return
+	}
+	data = map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !generatorKeyPattern.MatchString(key) {
+			err = errors.New(file + ":" + strconv.Itoa(n) + ": invalid line, expecting 'KEY=VALUE'")
+			return
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if value, err = strconv.Unquote(value); err != nil {
+					err = errors.New(file + ":" + strconv.Itoa(n) + ": " + err.Error())
+					return
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		data[key] = []byte(value)
+	}
+	err = scanner.Err()
+	return
+}
+
+// generateResource create a ConfigMap or Secret resource from a generator directory or env file
+func generateResource(file string, isDir bool, namespace string, opts LoadOptions) (res Resource, ok bool, err error) {
+	kind, name := generatorKind(file, isDir)
+	if kind == "" {
+		return
+	}
+
+	var data map[string][]byte
+	if isDir {
+		data, err = readGeneratorDir(file, opts.Ignore)
+	} else {
+		data, err = readGeneratorEnv(file)
+	}
+	if err != nil {
+		return
+	}
+
+	obj := map[string]any{
+		"apiVersion": "v1",
+		"kind":       kind,
+	}
+
+	var keys []string
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if kind == "Secret" {
+		obj["type"] = "Opaque"
+		encoded := map[string]string{}
+		for _, key := range keys {
+			encoded[key] = base64.StdEncoding.EncodeToString(data[key])
+		}
+		obj["data"] = encoded
+	} else {
+		text, binary := map[string]string{}, map[string]string{}
+		for _, key := range keys {
+			if utf8.Valid(data[key]) {
+				text[key] = string(data[key])
+			} else {
+				binary[key] = base64.StdEncoding.EncodeToString(data[key])
+			}
+		}
+		obj["data"] = text
+		if len(binary) > 0 {
+			obj["binaryData"] = binary
+		}
+	}
+
+	if opts.Generators.HashSuffix {
+		var buf []byte
+		if buf, err = json.Marshal(obj); err != nil {
+			return
+		}
+		name += "-" + strings.TrimPrefix(checksumBytes(buf), ChecksumPrefixSHA256)[:generatorHashLength]
+	}
+
+	obj["metadata"] = map[string]any{"name": name}
+
+	var raw []byte
+	if raw, err = json.Marshal(obj); err != nil {
+		return
+	}
+	if res, err = newResource(namespace, file, raw); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// generatedNames mapping from 'Kind/name' of generators to names of generated objects
+type generatedNames map[string]string
+
+// add record the resource if it's generated with a renamed object
+func (gn generatedNames) add(res Resource) {
+	for _, isDir := range []bool{true, false} {
+		if kind, name := generatorKind(res.Path, isDir); kind != "" && kind == res.Object.Kind && name != res.Object.Metadata.Name {
+			gn[kind+"/"+name] = res.Object.Metadata.Name
+		}
+	}
+}
+
+// podSpecPath returns path to pod spec of Pod, workloads and CronJob, nil for other kinds
+func podSpecPath(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec", "template", "spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	return nil
+}
+
+// rewrite rewrite references to generated ConfigMap and Secret in pod spec of resource, returns whether anything changed
+func (gn generatedNames) rewrite(res *Resource) (changed bool, err error) {
+	if len(gn) == 0 {
+		return
+	}
+	specPath := podSpecPath(res.Object.Kind)
+	if specPath == nil {
+		return
+	}
+
+	var obj map[string]any
+	if err = json.Unmarshal(res.Raw, &obj); err != nil {
+		return
+	}
+
+	spec := childMap(obj, specPath...)
+	if spec == nil {
+		return
+	}
+
+	ref := func(m map[string]any, kind string, field string) {
+		if m == nil {
+			return
+		}
+		name, _ := m[field].(string)
+		if renamed, ok := gn[kind+"/"+name]; ok {
+			m[field] = renamed
+			changed = true
+		}
+	}
+
+	for _, vol := range childSlice(spec, "volumes") {
+		ref(childMap(vol, "configMap"), "ConfigMap", "name")
+		ref(childMap(vol, "secret"), "Secret", "secretName")
+		for _, source := range childSlice(childMap(vol, "projected"), "sources") {
+			ref(childMap(source, "configMap"), "ConfigMap", "name")
+			ref(childMap(source, "secret"), "Secret", "name")
+		}
+	}
+	for _, secret := range childSlice(spec, "imagePullSecrets") {
+		ref(secret, "Secret", "name")
+	}
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, container := range childSlice(spec, field) {
+			for _, envFrom := range childSlice(container, "envFrom") {
+				ref(childMap(envFrom, "configMapRef"), "ConfigMap", "name")
+				ref(childMap(envFrom, "secretRef"), "Secret", "name")
+			}
+			for _, env := range childSlice(container, "env") {
+				ref(childMap(env, "valueFrom", "configMapKeyRef"), "ConfigMap", "name")
+				ref(childMap(env, "valueFrom", "secretKeyRef"), "Secret", "name")
+			}
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	var raw []byte
+	if raw, err = json.Marshal(obj); err != nil {
+		return
+	}
+	var updated Resource
+	if updated, err = newResource(res.Namespace, res.Path, raw); err != nil {
+		return
+	}
+	updated.ID = res.ID
+	*res = updated
+	return
+}
+
+func childMap(m map[string]any, path ...string) map[string]any {
+	for _, key := range path {
+		if m == nil {
+			return nil
+		}
+		m, _ = m[key].(map[string]any)
+	}
+	return m
+}
+
+func childSlice(m map[string]any, key string) (out []map[string]any) {
+	if m == nil {
+		return
+	}
+	items, _ := m[key].([]any)
+	for _, item := range items {
+		if child, ok := item.(map[string]any); ok {
+			out = append(out, child)
+		}
+	}
+	return
+}
@@ -0,0 +1,107 @@
+package ezdeploy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadGenerators(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "default")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nginx.configmap.d", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.configmap.d", "nginx.conf"), []byte("worker_processes 1;\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.configmap.d", "logo.bin"), []byte{0xff, 0xfe}, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.configmap.d", "sub", "ignored.yaml"), []byte("kind: Pod\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.secret.env"), []byte("# comment\n\nPASSWORD=\"hello world\"\nTOKEN='abc'\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      volumes:
+        - name: conf
+          configMap:
+            name: nginx
+        - name: other
+          configMap:
+            name: other
+      containers:
+        - name: nginx
+          envFrom:
+            - secretRef:
+                name: app
+          env:
+            - name: TOKEN
+              valueFrom:
+                secretKeyRef:
+                  name: app
+                  key: TOKEN
+`), 0644))
+
+	load := func(hashSuffix bool) map[string]Resource {
+		result, err := Load(root, "default", LoadOptions{Generators: GeneratorConfig{HashSuffix: hashSuffix}})
+		require.NoError(t, err)
+		out := map[string]Resource{}
+		for _, res := range result.Resources {
+			out[res.Object.Kind] = res
+		}
+		require.Len(t, out, 3)
+		return out
+	}
+
+	out := load(false)
+	require.Equal(t, "nginx", out["ConfigMap"].Object.Metadata.Name)
+	require.Equal(t, "default::v1/Secret/app", out["Secret"].ID)
+
+	var cm struct {
+		Data       map[string]string `json:"data"`
+		BinaryData map[string]string `json:"binaryData"`
+	}
+	require.NoError(t, json.Unmarshal(out["ConfigMap"].Raw, &cm))
+	require.Equal(t, map[string]string{"nginx.conf": "worker_processes 1;\n"}, cm.Data)
+	require.Equal(t, map[string]string{"logo.bin": "//4="}, cm.BinaryData)
+
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(out["Secret"].Raw, &secret))
+	require.Equal(t, map[string]string{"PASSWORD": "aGVsbG8gd29ybGQ=", "TOKEN": "YWJj"}, secret.Data)
+
+	plain := out["Deployment"]
+
+	out = load(true)
+	cmName := out["ConfigMap"].Object.Metadata.Name
+	secretName := out["Secret"].Object.Metadata.Name
+	require.Regexp(t, `^nginx-[0-9a-f]{10}$`, cmName)
+	require.Regexp(t, `^app-[0-9a-f]{10}$`, secretName)
+
+	deployment := out["Deployment"]
+	require.Equal(t, plain.ID, deployment.ID)
+	require.NotEqual(t, plain.Checksum, deployment.Checksum)
+	raw := string(deployment.Raw)
+	require.Contains(t, raw, `"configMap":{"name":"`+cmName+`"}`)
+	require.Contains(t, raw, `"configMap":{"name":"other"}`)
+	require.Contains(t, raw, `"secretRef":{"name":"`+secretName+`"}`)
+	require.Contains(t, raw, `"secretKeyRef":{"key":"TOKEN","name":"`+secretName+`"}`)
+
+	// content change renames
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.configmap.d", "nginx.conf"), []byte("worker_processes 2;\n"), 0644))
+	out = load(true)
+	require.NotEqual(t, cmName, out["ConfigMap"].Object.Metadata.Name)
+	require.Equal(t, secretName, out["Secret"].Object.Metadata.Name)
+}
+
+func TestReadGeneratorEnvInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.secret.env")
+	require.NoError(t, os.WriteFile(file, []byte("A=1\nnot a pair\n"), 0644))
+	_, err := readGeneratorEnv(file)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ":2:")
+}
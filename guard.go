@@ -0,0 +1,135 @@
+package ezdeploy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	PolicyCrossNamespace = "cross-namespace"
+	PolicyClusterScoped  = "cluster-scoped"
+)
+
+var (
+	ErrNamespaceGuardDenied = errors.New("denied by namespace guard")
+)
+
+// NamespaceAllow what a namespace directory may manage outside of its own namespace
+type NamespaceAllow struct {
+	// Namespaces other namespaces objects may target, '*' for any
+	Namespaces []string `yaml:"namespaces"`
+	// ClusterKinds kinds of cluster scoped objects allowed, '*' for any
+	ClusterKinds []string `yaml:"clusterKinds"`
+}
+
+// NamespaceGuardConfig guard against objects escaping their namespace directory
+type NamespaceGuardConfig struct {
+	// Mode severity of violations, one of off (default), warn and deny
+	Mode string `yaml:"mode"`
+	// Allow allowlist by namespace directory
+	Allow map[string]NamespaceAllow `yaml:"allow"`
+}
+
+// Validate check mode
+func (c NamespaceGuardConfig) Validate() error {
+	switch c.Mode {
+	case "", SeverityOff, SeverityWarn, SeverityDeny:
+		return nil
+	default:
+		return errors.New("invalid 'mode': '" + c.Mode + "'")
+	}
+}
+
+// Enabled returns whether the guard is enabled
+func (c NamespaceGuardConfig) Enabled() bool {
+	return c.Mode == SeverityWarn || c.Mode == SeverityDeny
+}
+
+func containsOrWildcard(items []string, s string) bool {
+	for _, item := range items {
+		if item == s || item == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterScopedKinds set of cluster scoped kinds, keyed by 'apiVersion/Kind'
+type ClusterScopedKinds map[string]bool
+
+// Has returns whether kind of obj is cluster scoped
+func (k ClusterScopedKinds) Has(obj Object) bool {
+	return k[obj.APIVersion+"/"+obj.Kind]
+}
+
+// DiscoverClusterScopedKinds discover cluster scoped kinds served by the cluster, groups failed to discover
+// are ignored
+func DiscoverClusterScopedKinds(client discovery.DiscoveryInterface) (kinds ClusterScopedKinds, err error) {
+	var lists []*metav1.APIResourceList
+	if _, lists, err = client.ServerGroupsAndResources(); err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return
+		}
+		err = nil
+	}
+	kinds = ClusterScopedKinds{}
+	for _, list := range lists {
+		for _, res := range list.APIResources {
+			// skip subresources
+			if strings.Contains(res.Name, "/") || res.Namespaced {
+				continue
+			}
+			kinds[list.GroupVersion+"/"+res.Kind] = true
+		}
+	}
+	return
+}
+
+// Check check resources of a namespace directory, objects with an explicit namespace other than the directory,
+// and cluster scoped objects, must be allowed. Returns all violations, and an error wrapping
+// ErrNamespaceGuardDenied if mode is deny
+func (c NamespaceGuardConfig) Check(namespace string, resources []Resource, kinds ClusterScopedKinds) (violations []PolicyViolation, err error) {
+	if !c.Enabled() {
+		return
+	}
+
+	allow := c.Allow[namespace]
+
+	var denied []string
+
+	for _, res := range resources {
+		var v PolicyViolation
+		if kinds.Has(res.Object) {
+			if containsOrWildcard(allow.ClusterKinds, res.Object.Kind) {
+				continue
+			}
+			v = PolicyViolation{
+				Rule:    PolicyClusterScoped,
+				Message: "cluster scoped kind '" + res.Object.Kind + "' is not allowed in namespace directory '" + namespace + "'",
+			}
+		} else {
+			target := res.Object.Metadata.Namespace
+			if target == "" || target == namespace || containsOrWildcard(allow.Namespaces, target) {
+				continue
+			}
+			v = PolicyViolation{
+				Rule:    PolicyCrossNamespace,
+				Message: "namespace '" + target + "' is not allowed in namespace directory '" + namespace + "'",
+			}
+		}
+		v.Severity, v.ID, v.Path = c.Mode, res.ID, res.Path
+		if v.Severity == SeverityDeny {
+			denied = append(denied, v.String())
+		}
+		violations = append(violations, v)
+	}
+
+	if len(denied) > 0 {
+		err = fmt.Errorf("%w: %s", ErrNamespaceGuardDenied, strings.Join(denied, "; "))
+	}
+	return
+}
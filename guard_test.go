@@ -0,0 +1,82 @@
+package ezdeploy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoverClusterScopedKinds(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false},
+				{Name: "namespaces/status", Kind: "Namespace", Namespaced: false},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusterroles", Kind: "ClusterRole", Namespaced: false},
+			},
+		},
+	}
+
+	kinds, err := DiscoverClusterScopedKinds(client.Discovery())
+	require.NoError(t, err)
+	require.Equal(t, ClusterScopedKinds{
+		"v1/Namespace": true,
+		"rbac.authorization.k8s.io/v1/ClusterRole": true,
+	}, kinds)
+}
+
+func TestNamespaceGuard(t *testing.T) {
+	kinds := ClusterScopedKinds{"rbac.authorization.k8s.io/v1/ClusterRole": true, "v1/Namespace": true}
+
+	newRes := func(apiVersion, kind, name, namespace string) Resource {
+		obj := Object{APIVersion: apiVersion, Kind: kind, Metadata: ObjectMeta{Name: name, Namespace: namespace}}
+		return Resource{ID: CreateResourceID("team-a", obj), Namespace: "team-a", Object: obj}
+	}
+
+	resources := []Resource{
+		newRes("v1", "ConfigMap", "own", ""),
+		newRes("v1", "ConfigMap", "explicit", "team-a"),
+		newRes("v1", "ConfigMap", "jobs", "team-a-jobs"),
+		newRes("v1", "ConfigMap", "escape", "kube-system"),
+		newRes("rbac.authorization.k8s.io/v1", "ClusterRole", "reader", ""),
+		newRes("v1", "Namespace", "team-a", ""),
+	}
+
+	cfg := NamespaceGuardConfig{
+		Mode: SeverityDeny,
+		Allow: map[string]NamespaceAllow{
+			"team-a": {Namespaces: []string{"team-a-jobs"}, ClusterKinds: []string{"ClusterRole"}},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	violations, err := cfg.Check("team-a", resources, kinds)
+	require.True(t, errors.Is(err, ErrNamespaceGuardDenied))
+	require.Len(t, violations, 2)
+	require.Equal(t, PolicyCrossNamespace, violations[0].Rule)
+	require.Equal(t, "kube-system::v1/ConfigMap/escape", violations[0].ID)
+	require.Equal(t, PolicyClusterScoped, violations[1].Rule)
+
+	cfg.Mode = SeverityWarn
+	violations, err = cfg.Check("team-a", resources, kinds)
+	require.NoError(t, err)
+	require.Len(t, violations, 2)
+
+	violations, err = NamespaceGuardConfig{}.Check("team-a", resources, kinds)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	require.Error(t, NamespaceGuardConfig{Mode: "reject"}.Validate())
+}
@@ -0,0 +1,147 @@
+package ezdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SubdirHooks = "_hooks"
+
+	HookPhasePreSync  = "pre-sync"
+	HookPhasePostSync = "post-sync"
+
+	AnnotationHookDeletePolicy = "ezdeploy.yankeguo.github.io/hook-delete-policy"
+
+	HookDeletePolicyBeforeHookCreation = "before-hook-creation"
+	HookDeletePolicyHookSucceeded      = "hook-succeeded"
+	HookDeletePolicyHookFailed         = "hook-failed"
+)
+
+// Hook a Job executed before or after syncing a namespace
+type Hook struct {
+	Resource
+	Phase        string
+	DeletePolicy []string
+}
+
+// HasDeletePolicy returns whether the hook has the given deletion policy
+func (h Hook) HasDeletePolicy(policy string) bool {
+	for _, item := range h.DeletePolicy {
+		if item == policy {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateHookID(namespace string, phase string, name string) string {
+	return namespace + "::" + "Hook" + "::" + phase + "/" + name
+}
+
+type hookObject struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+}
+
+func parseHookDeletePolicy(s string) (policy []string, err error) {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		switch item {
+		case "":
+			continue
+		case HookDeletePolicyBeforeHookCreation, HookDeletePolicyHookSucceeded, HookDeletePolicyHookFailed:
+			policy = append(policy, item)
+		default:
+			err = errors.New("invalid hook delete policy: '" + item + "'")
+			return
+		}
+	}
+	if len(policy) == 0 {
+		policy = []string{HookDeletePolicyBeforeHookCreation}
+	}
+	return
+}
+
+func collectHooks(root string, namespace string, phase string, opts LoadOptions) (hooks []Hook, err error) {
+	dir := filepath.Join(root, namespace, SubdirHooks, phase)
+
+	if _, err = os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	var errs []error
+
+	if err = walkResources(dir, namespace, opts, func(res Resource) {
+		if res.Object.APIVersion != "batch/v1" || res.Object.Kind != "Job" {
+			errs = append(errs, errors.New("hook is not a batch/v1 Job: "+res.Path))
+			return
+		}
+		if res.Object.Metadata.Namespace != "" && res.Object.Metadata.Namespace != namespace {
+			errs = append(errs, errors.New("hook must not target another namespace: "+res.Path))
+			return
+		}
+		var obj hookObject
+		if err := json.Unmarshal(res.Raw, &obj); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		policy, err := parseHookDeletePolicy(obj.Metadata.Annotations[AnnotationHookDeletePolicy])
+		if err != nil {
+			errs = append(errs, errors.New(res.Path+": "+err.Error()))
+			return
+		}
+		hook := Hook{Resource: res, Phase: phase, DeletePolicy: policy}
+		hook.ID = CreateHookID(namespace, phase, res.Object.Metadata.Name)
+		hooks = append(hooks, hook)
+	}); err != nil {
+		return
+	}
+
+	err = errors.Join(errs...)
+	return
+}
+
+// DeleteJob delete a Job with its pods, and wait until it is gone
+func DeleteJob(ctx context.Context, client kubernetes.Interface, namespace string, name string) (err error) {
+	propagation := metav1.DeletePropagationForeground
+	if err = client.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	}); err != nil {
+		if k8s_errors.IsNotFound(err) {
+			err = nil
+		}
+		return
+	}
+
+	ticker := time.NewTicker(DefaultRolloutInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err = client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			if k8s_errors.IsNotFound(err) {
+				err = nil
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
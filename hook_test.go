@@ -0,0 +1,36 @@
+package ezdeploy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHookDeletePolicy(t *testing.T) {
+	policy, err := parseHookDeletePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, []string{HookDeletePolicyBeforeHookCreation}, policy)
+
+	policy, err = parseHookDeletePolicy("hook-succeeded, hook-failed")
+	require.NoError(t, err)
+	require.Equal(t, []string{HookDeletePolicyHookSucceeded, HookDeletePolicyHookFailed}, policy)
+
+	_, err = parseHookDeletePolicy("never")
+	require.Error(t, err)
+}
+
+func TestCollectHooks(t *testing.T) {
+	hooks, err := collectHooks(filepath.Join("testdata", "root"), "default", HookPhasePreSync, LoadOptions{})
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	require.Equal(t, "migrate", hooks[0].Object.Metadata.Name)
+	require.Equal(t, "default::Hook::pre-sync/migrate", hooks[0].ID)
+	require.True(t, hooks[0].HasDeletePolicy(HookDeletePolicyHookSucceeded))
+	require.False(t, hooks[0].HasDeletePolicy(HookDeletePolicyHookFailed))
+
+	hooks, err = collectHooks(filepath.Join("testdata", "root"), "default", HookPhasePostSync, LoadOptions{})
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	require.Equal(t, []string{HookDeletePolicyBeforeHookCreation}, hooks[0].DeletePolicy)
+}
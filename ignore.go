@@ -0,0 +1,238 @@
+package ezdeploy
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	IgnoreFile = ".ezdeployignore"
+)
+
+type ignoreRule struct {
+	base    string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+	return r.re.MatchString(rel)
+}
+
+// compileIgnorePattern convert a gitignore style glob to a regular expression
+func compileIgnorePattern(p string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	sb := &strings.Builder{}
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				if i+2 < len(p) && p[i+2] == '/' {
+					// '**/' matches zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					sb.WriteString(".*")
+					i += 1
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			if j := strings.IndexByte(p[i:], ']'); j > 1 {
+				class := p[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				sb.WriteString("[" + class + "]")
+				i += j
+			} else {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		case '\\':
+			if i+1 < len(p) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(p[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func parseIgnoreRules(base string, lines []string) (rules []ignoreRule, err error) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		rule.base = base
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if rule.re, err = compileIgnorePattern(line); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// Ignore matches paths under the resource root against gitignore style rules, from extra patterns
+// and from '.ezdeployignore' files in every directory, loaded lazily
+type Ignore struct {
+	root  string
+	extra []ignoreRule
+	dirs  map[string][]ignoreRule
+	lock  *sync.Mutex
+}
+
+// NewIgnore create an Ignore for root, patterns are treated as lines of a root '.ezdeployignore'
+func NewIgnore(root string, patterns []string) (ig *Ignore, err error) {
+	ig = &Ignore{
+		root: root,
+		dirs: map[string][]ignoreRule{},
+		lock: &sync.Mutex{},
+	}
+	if ig.extra, err = parseIgnoreRules("", patterns); err != nil {
+		return
+	}
+	return
+}
+
+func (ig *Ignore) dirRules(dir string) (rules []ignoreRule, err error) {
+	ig.lock.Lock()
+	defer ig.lock.Unlock()
+
+	var ok bool
+	if rules, ok = ig.dirs[dir]; ok {
+		return
+	}
+
+	var buf []byte
+	if buf, err = os.ReadFile(filepath.Join(ig.root, filepath.FromSlash(dir), IgnoreFile)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			ig.dirs[dir] = nil
+		}
+		return
+	}
+
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	if rules, err = parseIgnoreRules(dir, lines); err != nil {
+		return
+	}
+	ig.dirs[dir] = rules
+	return
+}
+
+func (ig *Ignore) matchSelf(rel string, isDir bool) (ignored bool, err error) {
+	rules := append([]ignoreRule{}, ig.extra...)
+
+	// rules from the root directory down to the parent directory, deeper rules take precedence
+	var dirs []string
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	dirs = append([]string{""}, dirs...)
+
+	for _, dir := range dirs {
+		var items []ignoreRule
+		if items, err = ig.dirRules(dir); err != nil {
+			return
+		}
+		rules = append(rules, items...)
+	}
+
+	for _, rule := range rules {
+		if rule.match(rel, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return
+}
+
+// Match returns whether a path relative to root is ignored, either itself or by any of its parent directories
+func (ig *Ignore) Match(rel string, isDir bool) (ignored bool, err error) {
+	if ig == nil {
+		return
+	}
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return
+	}
+	// parent directories, a file can not be re-included if its parent directory is ignored
+	segs := strings.Split(rel, "/")
+	for i := 1; i < len(segs); i++ {
+		if ignored, err = ig.matchSelf(strings.Join(segs[:i], "/"), true); err != nil || ignored {
+			return
+		}
+	}
+	ignored, err = ig.matchSelf(rel, isDir)
+	return
+}
+
+// MatchFile same as Match, but with a file path instead of a path relative to root
+func (ig *Ignore) MatchFile(file string, isDir bool) (ignored bool, err error) {
+	if ig == nil {
+		return
+	}
+	var rel string
+	if rel, err = filepath.Rel(ig.root, file); err != nil {
+		err = nil
+		return
+	}
+	return ig.Match(rel, isDir)
+}
+
+// ignored returns whether the file under root is ignored, or is a dot/underscore prefixed entry
+func (ig *Ignore) ignored(file string, isDir bool) (bool, error) {
+	name := filepath.Base(file)
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		return true, nil
+	}
+	return ig.MatchFile(file, isDir)
+}
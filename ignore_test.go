@@ -0,0 +1,82 @@
+package ezdeploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	for pattern, cases := range map[string]map[string]bool{
+		"*.md":          {"README.md": true, "a/b/README.md": true, "README.mdx": false},
+		"/build":        {"build": true, "a/build": false},
+		"docs/*.yaml":   {"docs/a.yaml": true, "docs/a/b.yaml": false, "x/docs/a.yaml": false},
+		"**/fixtures":   {"fixtures": true, "a/b/fixtures": true},
+		"a/**/b":        {"a/b": true, "a/x/y/b": true, "c/a/b": false},
+		"test-[0-9].js": {"test-1.js": true, "test-a.js": false},
+	} {
+		re, err := compileIgnorePattern(pattern)
+		require.NoError(t, err)
+		for rel, expected := range cases {
+			require.Equal(t, expected, re.MatchString(rel), pattern+" => "+rel)
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default", "fixtures"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, IgnoreFile), []byte("# comment\n*.md\nscratch/\n"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", IgnoreFile), []byte("fixtures/\n!KEEP.md\n"), 0640))
+
+	ig, err := NewIgnore(root, []string{"*.tmp.yaml"})
+	require.NoError(t, err)
+
+	for rel, expected := range map[string]bool{
+		"scratch":                  true,
+		"default":                  false,
+		"default/README.md":        true,
+		"default/KEEP.md":          false,
+		"default/fixtures":         true,
+		"default/fixtures/a.yaml":  true,
+		"default/app.yaml":         false,
+		"default/app.tmp.yaml":     true,
+		"other/KEEP.md":            true,
+		"scratch/deployment.yaml":  true,
+		"default/sub/fixtures/a.y": true,
+	} {
+		isDir := filepath.Ext(rel) == ""
+		ignored, err := ig.Match(rel, isDir)
+		require.NoError(t, err)
+		require.Equal(t, expected, ignored, rel)
+	}
+
+	ignored, err := (*Ignore)(nil).Match("README.md", false)
+	require.NoError(t, err)
+	require.False(t, ignored)
+}
+
+func TestLoadWithIgnore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default", "fixtures"), 0750))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "scratch"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, IgnoreFile), []byte("scratch/\n"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", IgnoreFile), []byte("fixtures/\n"), 0640))
+	doc := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: demo\n")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "cm.yaml"), doc, 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "fixtures", "cm.yaml"), doc, 0640))
+
+	ig, err := NewIgnore(root, nil)
+	require.NoError(t, err)
+
+	res, err := Scan(root, ScanOptions{Ignore: ig})
+	require.NoError(t, err)
+	require.Equal(t, []string{"default"}, res.Namespaces)
+
+	res1, err := Load(root, "default", LoadOptions{Ignore: ig})
+	require.NoError(t, err)
+	require.Len(t, res1.Resources, 1)
+	require.Equal(t, filepath.Join(root, "default", "cm.yaml"), res1.Resources[0].Path)
+}
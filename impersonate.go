@@ -0,0 +1,55 @@
+package ezdeploy
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// ImpersonateDefault key of the default identity in Config.Impersonate
+	ImpersonateDefault = "*"
+)
+
+// Impersonation identity impersonated when syncing a namespace
+type Impersonation struct {
+	// User user name
+	User string `yaml:"user"`
+	// ServiceAccount service account, 'name' in the namespace being synced, or 'namespace:name'
+	ServiceAccount string `yaml:"serviceAccount"`
+	// Groups groups, requires user or service account
+	Groups []string `yaml:"groups"`
+}
+
+// Validate check fields
+func (i Impersonation) Validate() error {
+	if i.User != "" && i.ServiceAccount != "" {
+		return errors.New("'user' and 'serviceAccount' are mutually exclusive")
+	}
+	if i.User == "" && i.ServiceAccount == "" && len(i.Groups) > 0 {
+		return errors.New("'groups' requires 'user' or 'serviceAccount'")
+	}
+	if strings.Count(i.ServiceAccount, ":") > 1 {
+		return errors.New("invalid 'serviceAccount': '" + i.ServiceAccount + "'")
+	}
+	return nil
+}
+
+// Resolve returns the identity with user name resolved for namespace, service account is converted to user
+func (i Impersonation) Resolve(namespace string) Impersonation {
+	if i.ServiceAccount == "" {
+		return i
+	}
+	ns, name := namespace, i.ServiceAccount
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		ns, name = name[:idx], name[idx+1:]
+	}
+	return Impersonation{
+		User:   "system:serviceaccount:" + ns + ":" + name,
+		Groups: i.Groups,
+	}
+}
+
+// IsZero returns whether nothing is impersonated
+func (i Impersonation) IsZero() bool {
+	return i.User == "" && i.ServiceAccount == ""
+}
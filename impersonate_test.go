@@ -0,0 +1,37 @@
+package ezdeploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonation(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Impersonate = map[string]Impersonation{
+		"team-a":           {ServiceAccount: "deployer", Groups: []string{"team-a"}},
+		"team-b":           {ServiceAccount: "ci:team-b-deployer"},
+		ImpersonateDefault: {User: "ezdeploy"},
+	}
+	require.NoError(t, cfg.Validate())
+
+	require.Equal(t, Impersonation{User: "system:serviceaccount:team-a:deployer", Groups: []string{"team-a"}}, cfg.ImpersonationFor("team-a"))
+	require.Equal(t, "system:serviceaccount:ci:team-b-deployer", cfg.ImpersonationFor("team-b").User)
+	require.Equal(t, "ezdeploy", cfg.ImpersonationFor("team-c").User)
+	require.True(t, DefaultConfig().ImpersonationFor("team-a").IsZero())
+
+	// state uses the '*' entry, or its own identity, an empty one opts out
+	require.Equal(t, "ezdeploy", cfg.StateImpersonation().User)
+	cfg.State.Impersonate = &Impersonation{ServiceAccount: "state-keeper"}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, "system:serviceaccount:"+DefaultStateNamespace+":state-keeper", cfg.StateImpersonation().User)
+	cfg.State.Impersonate = &Impersonation{}
+	require.True(t, cfg.StateImpersonation().IsZero())
+	require.True(t, DefaultConfig().StateImpersonation().IsZero())
+	cfg.State.Impersonate = &Impersonation{Groups: []string{"a"}}
+	require.Error(t, cfg.Validate())
+
+	require.Error(t, Impersonation{User: "a", ServiceAccount: "b"}.Validate())
+	require.Error(t, Impersonation{Groups: []string{"a"}}.Validate())
+	require.Error(t, Impersonation{ServiceAccount: "a:b:c"}.Validate())
+}
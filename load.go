@@ -4,67 +4,167 @@ import (
 	"encoding/json"
 	"github.com/karrick/godirwalk"
 	"path/filepath"
-	"strings"
 )
 
 type LoadResult struct {
-	Releases     []Release
-	Resources    []Resource
-	ResourcesExt []Resource
+	Releases      []Release
+	Resources     []Resource
+	ResourcesExt  []Resource
+	PreSyncHooks  []Hook
+	PostSyncHooks []Hook
 }
 
 type LoadOptions struct {
-	Charts map[string]Chart
+	Charts     map[string]Chart
+	FileTypes  FileTypes
+	ExtVars    map[string]string
+	Ignore     *Ignore
+	Generators GeneratorConfig
+}
+
+func (opts LoadOptions) fileTypes() FileTypes {
+	if opts.FileTypes == nil {
+		return DefaultFileTypes()
+	}
+	return opts.FileTypes
 }
 
 func Load(root string, namespace string, opts LoadOptions) (result LoadResult, err error) {
-	if err = godirwalk.Walk(filepath.Join(root, namespace), &godirwalk.Options{
+	names := generatedNames{}
+
+	if err = walkResources(filepath.Join(root, namespace), namespace, opts, func(res Resource) {
+		names.add(res)
+		if res.Object.Metadata.Namespace == "" {
+			result.Resources = append(result.Resources, res)
+		} else {
+			result.ResourcesExt = append(result.ResourcesExt, res)
+		}
+	}); err != nil {
+		return
+	}
+
+	if result.PreSyncHooks, err = collectHooks(root, namespace, HookPhasePreSync, opts); err != nil {
+		return
+	}
+
+	if result.PostSyncHooks, err = collectHooks(root, namespace, HookPhasePostSync, opts); err != nil {
+		return
+	}
+
+	if result.Releases, err = collectReleases(root, namespace, opts); err != nil {
+		return
+	}
+
+	// rewrite references to renamed ConfigMap and Secret in the same namespace
+	for i := range result.Resources {
+		if _, err = names.rewrite(&result.Resources[i]); err != nil {
+			return
+		}
+	}
+	for i := range result.ResourcesExt {
+		if result.ResourcesExt[i].Object.Metadata.Namespace != namespace {
+			continue
+		}
+		if _, err = names.rewrite(&result.ResourcesExt[i]); err != nil {
+			return
+		}
+	}
+	for _, hooks := range [][]Hook{result.PreSyncHooks, result.PostSyncHooks} {
+		for i := range hooks {
+			if _, err = names.rewrite(&hooks[i].Resource); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func walkResources(dir string, namespace string, opts LoadOptions, fn func(res Resource)) error {
+	return godirwalk.Walk(dir, &godirwalk.Options{
 		FollowSymbolicLinks: true,
 		Callback: func(file string, entry *godirwalk.Dirent) (err error) {
-			if entry.IsDir() ||
-				strings.HasPrefix(entry.Name(), ".") ||
-				strings.HasPrefix(entry.Name(), "_") {
+			if file != dir {
+				var ignored bool
+				if ignored, err = opts.Ignore.ignored(file, entry.IsDir()); err != nil {
+					return
+				}
+				if ignored {
+					if entry.IsDir() {
+						return godirwalk.SkipThis
+					}
+					return
+				}
+			}
+
+			var res Resource
+			var ok bool
+			if res, ok, err = generateResource(file, entry.IsDir(), namespace, opts); err != nil {
+				return
+			}
+			if ok {
+				fn(res)
+				if entry.IsDir() {
+					return godirwalk.SkipThis
+				}
 				return
 			}
 
-			var raws []json.RawMessage
-			if raws, err = collectResourceFile(file, namespace); err != nil {
+			if entry.IsDir() {
 				return
 			}
 
-			if len(raws) == 0 {
+			var raws []json.RawMessage
+			if raws, err = collectResourceFile(file, namespace, opts); err != nil {
 				return
 			}
 
 			for _, raw := range raws {
-				res := Resource{
-					Namespace: namespace,
-					Raw:       raw,
-					Path:      file,
-					Checksum:  checksumBytes(raw),
-				}
-
-				if err = json.Unmarshal(raw, &res.Object); err != nil {
+				var res Resource
+				if res, err = newResource(namespace, file, raw); err != nil {
 					return
 				}
-
-				res.ID = CreateResourceID(namespace, res.Object)
-
-				if res.Object.Metadata.Namespace == "" {
-					result.Resources = append(result.Resources, res)
-				} else {
-					result.ResourcesExt = append(result.ResourcesExt, res)
-				}
+				fn(res)
 			}
 			return
 		},
-	}); err != nil {
-		return
+	})
+}
+
+func newResource(namespace string, file string, raw json.RawMessage) (res Resource, err error) {
+	res = Resource{
+		Namespace: namespace,
+		Raw:       raw,
+		Path:      file,
+		Checksum:  checksumBytes(raw),
+
+		LegacyChecksum: legacyChecksumBytes(raw),
 	}
 
-	if result.Releases, err = collectReleases(root, namespace, opts.Charts); err != nil {
+	if err = json.Unmarshal(raw, &res.Object); err != nil {
 		return
 	}
 
+	res.ID = CreateResourceID(namespace, res.Object)
+	return
+}
+
+// ParseManifests parse multi-document YAML manifests, e.g. output of 'helm template', into resources of
+// namespace, empty documents are skipped
+func ParseManifests(namespace string, path string, buf []byte) (resources []Resource, err error) {
+	var raws []json.RawMessage
+	if err = collectYAMLContent(&raws, buf); err != nil {
+		return
+	}
+	if err = sanitizeRawResources(&raws); err != nil {
+		return
+	}
+	for _, raw := range raws {
+		var res Resource
+		if res, err = newResource(namespace, path, raw); err != nil {
+			return
+		}
+		resources = append(resources, res)
+	}
 	return
 }
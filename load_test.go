@@ -7,12 +7,17 @@ import (
 )
 
 func TestLoad(t *testing.T) {
-	res, err := Scan(filepath.Join("testdata", "root"))
+	res, err := Scan(filepath.Join("testdata", "root"), ScanOptions{})
 	require.NoError(t, err)
 
 	res1, err := Load(filepath.Join("testdata", "root"), res.Namespaces[0], LoadOptions{
 		Charts: res.Charts,
 	})
 	require.NoError(t, err)
-	_ = res1
+	require.Len(t, res1.Resources, 3)
+	require.Len(t, res1.PreSyncHooks, 1)
+	require.Len(t, res1.PostSyncHooks, 1)
+	for _, res := range res1.Resources {
+		require.NotEqual(t, "Job", res.Object.Kind)
+	}
 }
@@ -1,21 +1,19 @@
 package ezblob
 
 import (
+	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 
-	corev1 "k8s.io/api/core/v1"
-	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"github.com/yankeguo/ezdeploy/pkg/ezsync"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/kubernetes"
-	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 const (
@@ -26,62 +24,146 @@ const (
 	LabelKeyName      = "yankeguo.github.io/ezblob-name"
 	LabelKeyRevision  = "yankeguo.github.io/ezblob-revision"
 
-	KeyName     = "name"
-	KeyRevision = "revision"
-	KeyChunks   = "chunks"
-	KeyChecksum = "checksum"
+	KeyName           = "name"
+	KeyRevision       = "revision"
+	KeyChunks         = "chunks"
+	KeyChecksum       = "checksum"
+	KeyChunkChecksums = "chunkChecksums"
+
+	// KeyPrefixPrevious prefix of keys of the previous revision, kept as a fallback
+	KeyPrefixPrevious = "previous."
 
 	KeyData = "data"
 )
 
 const (
-	DefaultChunkSize = 4096
+	// MaxChunkSize maximum size of a chunk, limited by the 1 MiB size limit of Secret and ConfigMap data
+	MaxChunkSize = 1024 * 1024
+	// DefaultChunkSize default size of a chunk, leaving room for keys of data
+	DefaultChunkSize = MaxChunkSize - 16*1024
+	// DefaultConcurrency default maximum number of chunks read or written concurrently
+	DefaultConcurrency = 8
 )
 
 var (
 	ErrNotFound         = errors.New("not found")
 	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrChunkMissing     = errors.New("chunk missing")
+
+	ErrInvalidHeaderFieldName     = errors.New("missing or invalid field in header: 'name'")
+	ErrInvalidHeaderFieldChecksum = errors.New("missing or invalid field in header: 'checksum'")
+	ErrInvalidHeaderFieldRevision = errors.New("missing or invalid field in header: 'revision'")
+	ErrInvalidHeaderFieldChunks   = errors.New("missing or invalid field in header: 'chunks'")
 
-	ErrInvalidHeaderFieldName     = errors.New("missing or invalid field in header secret: 'name'")
-	ErrInvalidHeaderFieldChecksum = errors.New("missing or invalid field in header secret: 'checksum'")
-	ErrInvalidHeaderFieldRevision = errors.New("missing or invalid field in header secret: 'revision'")
-	ErrInvalidHeaderFieldChunks   = errors.New("missing or invalid field in header secret: 'chunks'")
+	ErrInvalidHeaderFieldChunkChecksums = errors.New("invalid field in header: 'chunkChecksums'")
 )
 
-type blobHeader struct {
-	Name     string
+type blobRevision struct {
+	Revision string
 	Chunks   int
 	Checksum string
-	Revision string
+	// ChunkChecksums checksums of each chunk, missing in headers written by previous versions
+	ChunkChecksums []string
+}
+
+// verifyChunk verify a chunk against its checksum, if available
+func (r blobRevision) verifyChunk(index int, data []byte) error {
+	if len(r.ChunkChecksums) != r.Chunks {
+		return nil
+	}
+	if !verifyChecksum(r.ChunkChecksums[index], data) {
+		return fmt.Errorf("%w: chunk %d of revision '%s'", ErrChecksumMismatch, index, r.Revision)
+	}
+	return nil
+}
+
+func (r blobRevision) toData(prefix string, data map[string][]byte) {
+	// all keys are always written, so that patching the header clears stale values
+	data[prefix+KeyRevision] = []byte(r.Revision)
+	data[prefix+KeyChecksum] = []byte(r.Checksum)
+	data[prefix+KeyChunks] = []byte(strconv.Itoa(r.Chunks))
+	data[prefix+KeyChunkChecksums] = []byte(strings.Join(r.ChunkChecksums, ","))
+}
+
+func parseBlobRevision(prefix string, data map[string][]byte) (r blobRevision, err error) {
+	r.Revision = string(data[prefix+KeyRevision])
+	if r.Revision == "" {
+		err = ErrInvalidHeaderFieldRevision
+		return
+	}
+	if r.Chunks, err = strconv.Atoi(string(data[prefix+KeyChunks])); err != nil {
+		err = ErrInvalidHeaderFieldChunks
+		return
+	}
+	if r.Chunks < 0 {
+		err = ErrInvalidHeaderFieldChunks
+		return
+	}
+	r.Checksum = string(data[prefix+KeyChecksum])
+	if r.Checksum == "" {
+		err = ErrInvalidHeaderFieldChecksum
+		return
+	}
+	if raw := string(data[prefix+KeyChunkChecksums]); raw != "" {
+		if r.ChunkChecksums = strings.Split(raw, ","); len(r.ChunkChecksums) != r.Chunks {
+			err = ErrInvalidHeaderFieldChunkChecksums
+			return
+		}
+	}
+	return
+}
+
+type blobHeader struct {
+	Name string
+	blobRevision
+	// Previous previous revision, kept until the current one is replaced, empty if none
+	Previous blobRevision
 }
 
 func (h blobHeader) ToData() map[string][]byte {
-	return map[string][]byte{
-		KeyName:     []byte(h.Name),
-		KeyRevision: []byte(h.Revision),
-		KeyChecksum: []byte(h.Checksum),
-		KeyChunks:   []byte(strconv.Itoa(h.Chunks)),
+	data := map[string][]byte{
+		KeyName: []byte(h.Name),
 	}
+	h.blobRevision.toData("", data)
+	h.Previous.toData(KeyPrefixPrevious, data)
+	return data
 }
 
 // Options Blob options
 type Options struct {
-	// Client kubernetes client
-	Client *kubernetes.Clientset
-	// Name Blob name, also used as Secret name
+	// Client kubernetes client, used to create a Secret storage if Storage is not set
+	Client kubernetes.Interface
+	// Storage optional storage of header and chunk objects, see NewSecretStorage, NewConfigMapStorage and
+	// NewMemoryStorage
+	Storage Storage
+	// Name Blob name, also used as name of header object
 	Name string
 	// Namespace kubernetes namespace
 	Namespace string
-	// ChunkSize maximum size of each chunk
+	// ChunkSize maximum size of each chunk, defaults to DefaultChunkSize, must not exceed MaxChunkSize
 	ChunkSize int
+	// Concurrency maximum number of chunks read or written concurrently, defaults to DefaultConcurrency
+	Concurrency int
+	// OnChunks optional callback, invoked with operation ("load" or "save") and number of chunks on success
+	OnChunks func(op string, chunks int)
+	// OnFallback optional callback, invoked when the current revision is corrupted and the previous revision is
+	// used instead
+	OnFallback func(revision string, previous string, err error)
 }
 
 type Blob struct {
-	client    *kubernetes.Clientset
+	storage   Storage
 	name      string
 	namespace string
 	chunkSize int
+	para      int
+	onChunks  func(op string, chunks int)
 	lock      sync.Locker
+
+	onFallback func(revision string, previous string, err error)
+	// corrupted revision found corrupted, it's never kept as a previous revision
+	corrupted     string
+	corruptedLock sync.Locker
 }
 
 // New create a Blob
@@ -89,124 +171,98 @@ func New(opts Options) (blob *Blob, err error) {
 	if opts.ChunkSize <= 0 {
 		opts.ChunkSize = DefaultChunkSize
 	}
-	if opts.Client == nil {
-		err = errors.New("ezblob: missing argument Options.Client")
+	if opts.ChunkSize > MaxChunkSize {
+		err = errors.New("ezblob: invalid argument Options.ChunkSize, must not exceed " + strconv.Itoa(MaxChunkSize))
 		return
 	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Storage == nil {
+		if opts.Client == nil {
+			err = errors.New("ezblob: missing argument Options.Client or Options.Storage")
+			return
+		}
+		opts.Storage = NewSecretStorage(opts.Client, opts.Namespace)
+	}
 	if opts.Name == "" {
 		err = errors.New("ezblob: missing argument Options.Name")
 		return
 	}
 	blob = &Blob{
-		client:    opts.Client,
+		storage:   opts.Storage,
 		name:      opts.Name,
 		namespace: opts.Namespace,
 		chunkSize: opts.ChunkSize,
+		para:      opts.Concurrency,
+		onChunks:  opts.OnChunks,
 		lock:      &sync.Mutex{},
+
+		onFallback:    opts.OnFallback,
+		corruptedLock: &sync.Mutex{},
 	}
 	return
 }
 
-func (b *Blob) apiSecret() clientcorev1.SecretInterface {
-	return b.client.CoreV1().Secrets(b.namespace)
-}
-
 func (b *Blob) headerGet(ctx context.Context) (h blobHeader, err error) {
-	var secret *corev1.Secret
-	if secret, err = b.apiSecret().Get(ctx, b.name, metav1.GetOptions{}); err != nil {
+	var obj Object
+	if obj, err = b.storage.Get(ctx, b.name); err != nil {
 		return
 	}
-	h.Name = string(secret.Data[KeyName])
+	h.Name = string(obj.Data[KeyName])
 	if h.Name != b.name {
 		err = ErrInvalidHeaderFieldName
 		return
 	}
-	h.Revision = string(secret.Data[KeyRevision])
-	if h.Revision == "" {
-		err = ErrInvalidHeaderFieldRevision
+	if h.blobRevision, err = parseBlobRevision("", obj.Data); err != nil {
 		return
 	}
-	if h.Chunks, err = strconv.Atoi(string(secret.Data[KeyChunks])); err != nil {
-		err = ErrInvalidHeaderFieldChunks
-		return
-	}
-	if h.Chunks < 0 {
-		err = ErrInvalidHeaderFieldChunks
-		return
-	}
-	h.Checksum = string(secret.Data[KeyChecksum])
-	if h.Checksum == "" {
-		err = ErrInvalidHeaderFieldChecksum
-		return
+	// previous revision is optional, and ignored if invalid
+	if len(obj.Data[KeyPrefixPrevious+KeyRevision]) > 0 {
+		if previous, err := parseBlobRevision(KeyPrefixPrevious, obj.Data); err == nil {
+			h.Previous = previous
+		}
 	}
 	return
 }
 
-func (b *Blob) headerCreate(ctx context.Context, h blobHeader) (err error) {
-	if _, err = b.apiSecret().Create(
-		ctx,
-		&corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: b.name,
-			},
-			Data: h.ToData(),
-			Type: corev1.SecretTypeOpaque,
-		},
-		metav1.CreateOptions{},
-	); err != nil {
-		return
-	}
-	return
+func (b *Blob) headerCreate(ctx context.Context, h blobHeader) error {
+	return b.storage.Create(ctx, Object{Name: b.name, Data: h.ToData()})
 }
 
-func (b *Blob) headerPatch(ctx context.Context, h blobHeader) (err error) {
-	var data []byte
-	if data, err = json.Marshal(corev1.Secret{Data: h.ToData()}); err != nil {
-		return
-	}
-	if _, err = b.apiSecret().Patch(
-		ctx,
-		b.name,
-		types.StrategicMergePatchType,
-		data,
-		metav1.PatchOptions{},
-	); err != nil {
-		return
-	}
-	return
+func (b *Blob) headerPatch(ctx context.Context, h blobHeader) error {
+	return b.storage.Patch(ctx, b.name, h.ToData())
 }
 
 func (b *Blob) headerDelete(ctx context.Context) error {
-	return b.apiSecret().Delete(ctx, b.name, metav1.DeleteOptions{})
+	return b.storage.Delete(ctx, b.name)
 }
 
-func (b *Blob) chunkSelector() string {
-	return fmt.Sprintf(
-		"%s = %s, %s = %s, %s = %s",
-		LabelKeyManagedBy, LabelValManagedBy,
-		LabelKeyComponent, LabelValComponent,
-		LabelKeyName, b.name,
-	)
+func (b *Blob) chunkSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{
+		LabelKeyManagedBy: LabelValManagedBy,
+		LabelKeyComponent: LabelValComponent,
+		LabelKeyName:      b.name,
+	})
 }
 
-func (b *Blob) chunkSelectorRevision(revision string) string {
-	return fmt.Sprintf(
-		"%s = %s, %s = %s, %s = %s, %s = %s",
-		LabelKeyManagedBy, LabelValManagedBy,
-		LabelKeyComponent, LabelValComponent,
-		LabelKeyName, b.name,
-		LabelKeyRevision, revision,
-	)
+func (b *Blob) chunkSelectorRevision(revision string) labels.Selector {
+	return labels.SelectorFromSet(b.chunkLabelsRevision(revision))
 }
 
-func (b *Blob) chunkSelectorNotRevision(revision string) string {
-	return fmt.Sprintf(
-		"%s = %s, %s = %s, %s = %s, %s != %s",
-		LabelKeyManagedBy, LabelValManagedBy,
-		LabelKeyComponent, LabelValComponent,
-		LabelKeyName, b.name,
-		LabelKeyRevision, revision,
-	)
+func (b *Blob) chunkSelectorNotRevisions(revisions ...string) labels.Selector {
+	var values []string
+	for _, revision := range revisions {
+		if revision != "" {
+			values = append(values, revision)
+		}
+	}
+	req, err := labels.NewRequirement(LabelKeyRevision, selection.NotIn, values)
+	if err != nil {
+		// revisions are always valid label values
+		panic(err)
+	}
+	return b.chunkSelector().Add(*req)
 }
 
 func (b *Blob) chunkName(revision string, idx int) string {
@@ -223,36 +279,156 @@ func (b *Blob) chunkLabelsRevision(revision string) map[string]string {
 }
 
 func (b *Blob) chunkGet(ctx context.Context, revision string, index int) (buf []byte, err error) {
-	var secret *corev1.Secret
-	if secret, err = b.apiSecret().Get(ctx, b.chunkName(revision, index), metav1.GetOptions{}); err != nil {
+	var obj Object
+	if obj, err = b.storage.Get(ctx, b.chunkName(revision, index)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = fmt.Errorf("ezblob: chunk '%s': %w", b.chunkName(revision, index), ErrChunkMissing)
+		}
 		return
 	}
-	buf = secret.Data[KeyData]
+	buf = obj.Data[KeyData]
 	return
 }
 
-func (b *Blob) chunkCreate(ctx context.Context, revision string, index int, data []byte) (err error) {
-	if _, err = b.apiSecret().Create(ctx, &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:   b.chunkName(revision, index),
-			Labels: b.chunkLabelsRevision(revision),
-		},
+// chunksGet get and verify all chunks of a revision, with a single List call if possible, chunks not listed are
+// fetched one by one concurrently
+func (b *Blob) chunksGet(ctx context.Context, rev blobRevision) (chunks [][]byte, err error) {
+	revision, count := rev.Revision, rev.Chunks
+	chunks = make([][]byte, count)
+	found := make([]bool, count)
+
+	if count > 1 {
+		// List may be forbidden or fail for other reasons, fallback to Get
+		if objs, err := b.storage.List(ctx, b.chunkSelectorRevision(revision)); err == nil {
+			names := map[string]int{}
+			for i := 0; i < count; i++ {
+				names[b.chunkName(revision, i)] = i
+			}
+			for _, obj := range objs {
+				if i, ok := names[obj.Name]; ok {
+					chunks[i], found[i] = obj.Data[KeyData], true
+				}
+			}
+		}
+	}
+
+	err = b.parallel(count, func(i int) (err error) {
+		if !found[i] {
+			if chunks[i], err = b.chunkGet(ctx, revision, i); err != nil {
+				return
+			}
+		}
+		return rev.verifyChunk(i, chunks[i])
+	})
+	return
+}
+
+// loadRevision load and verify all data of a revision
+func (b *Blob) loadRevision(ctx context.Context, rev blobRevision) (buf []byte, err error) {
+	var chunks [][]byte
+	if chunks, err = b.chunksGet(ctx, rev); err != nil {
+		return
+	}
+	buf = bytes.Join(chunks, nil)
+	if !verifyChecksum(rev.Checksum, buf) {
+		err = fmt.Errorf("%w: revision '%s'", ErrChecksumMismatch, rev.Revision)
+		return
+	}
+	return
+}
+
+// verifyRevision verify all chunks of a revision and its checksum, chunks are fetched in windows of the
+// concurrency and hashed in order, so that at most a window of chunks is kept in memory
+func (b *Blob) verifyRevision(ctx context.Context, rev blobRevision) (err error) {
+	h := newChecksumHash(rev.Checksum)
+	window := make([][]byte, b.para)
+	for start := 0; start < rev.Chunks; start += b.para {
+		n := min(b.para, rev.Chunks-start)
+		if err = b.parallel(n, func(i int) (err error) {
+			if window[i], err = b.chunkGet(ctx, rev.Revision, start+i); err != nil {
+				return
+			}
+			return rev.verifyChunk(start+i, window[i])
+		}); err != nil {
+			return
+		}
+		for i := 0; i < n; i++ {
+			h.Write(window[i])
+			window[i] = nil
+		}
+	}
+	if !checksumMatches(rev.Checksum, h) {
+		err = fmt.Errorf("%w: revision '%s'", ErrChecksumMismatch, rev.Revision)
+		return
+	}
+	return
+}
+
+// IsCorrupted returns whether err indicates missing or corrupted chunks
+func IsCorrupted(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrChunkMissing)
+}
+
+// fallback mark current revision as corrupted and notify, returns false if there is no previous revision
+func (b *Blob) fallback(h blobHeader, cause error) bool {
+	if h.Previous.Revision == "" {
+		return false
+	}
+	b.corruptedLock.Lock()
+	b.corrupted = h.Revision
+	b.corruptedLock.Unlock()
+
+	if b.onFallback != nil {
+		b.onFallback(h.Revision, h.Previous.Revision, cause)
+	}
+	return true
+}
+
+// isCorrupted returns whether revision is found corrupted
+func (b *Blob) isCorrupted(revision string) bool {
+	b.corruptedLock.Lock()
+	defer b.corruptedLock.Unlock()
+	return revision != "" && b.corrupted == revision
+}
+
+func (b *Blob) chunkCreate(ctx context.Context, revision string, index int, data []byte) error {
+	return b.storage.Create(ctx, Object{
+		Name:   b.chunkName(revision, index),
+		Labels: b.chunkLabelsRevision(revision),
 		Data: map[string][]byte{
 			KeyData: data,
 		},
-		Type: corev1.SecretTypeOpaque,
-	}, metav1.CreateOptions{}); err != nil {
-		return
+	})
+}
+
+// parallel invoke fn for indexes in [0, n) with bounded concurrency, returns the error of the lowest index
+func (b *Blob) parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	pg := ezsync.NewParaGroup(b.para)
+	for i := 0; i < n; i++ {
+		pg.Mark()
+		pg.Take()
+		go func(i int) {
+			defer pg.Done()
+			errs[i] = fn(i)
+		}(i)
 	}
-	return
+	pg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (b *Blob) chunkDeleteBySelector(ctx context.Context, sel string) error {
-	return b.apiSecret().DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: sel})
+func (b *Blob) chunkDeleteBySelector(ctx context.Context, sel labels.Selector) error {
+	return b.storage.DeleteCollection(ctx, sel)
 }
 
+// Delete delete header and all chunks
 func (b *Blob) Delete(ctx context.Context) (err error) {
-	if err = b.apiSecret().Delete(ctx, b.name, metav1.DeleteOptions{}); err != nil {
+	if err = b.headerDelete(ctx); err != nil {
 		return
 	}
 	if err = b.chunkDeleteBySelector(ctx, b.chunkSelector()); err != nil {
@@ -261,110 +437,46 @@ func (b *Blob) Delete(ctx context.Context) (err error) {
 	return
 }
 
-// Load load all data from kubernetes secrets
+// Load load all data from storage, if the current revision is corrupted, the previous revision is loaded instead
+// and Options.OnFallback is invoked
 func (b *Blob) Load(ctx context.Context) (buf []byte, err error) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
 	var h blobHeader
 	if h, err = b.headerGet(ctx); err != nil {
-		if k8s_errors.IsNotFound(err) {
+		if errors.Is(err, ErrNotFound) {
 			err = ErrNotFound
 		}
 		return
 	}
-	d := md5.New()
-	for i := 0; i < h.Chunks; i++ {
-		var chunk []byte
-		if chunk, err = b.chunkGet(ctx, h.Revision, i); err != nil {
+	rev := h.blobRevision
+	if buf, err = b.loadRevision(ctx, rev); err != nil {
+		if !IsCorrupted(err) || !b.fallback(h, err) {
+			return
+		}
+		cause := err
+		rev = h.Previous
+		if buf, err = b.loadRevision(ctx, rev); err != nil {
+			err = errors.Join(cause, err)
 			return
 		}
-		d.Write(chunk)
-		buf = append(buf, chunk...)
 	}
-	if h.Checksum != hex.EncodeToString(d.Sum(nil)) {
-		err = ErrChecksumMismatch
-		return
+	if b.onChunks != nil {
+		b.onChunks("load", rev.Chunks)
 	}
 	return
 }
 
-// Save save data to kubernetes secrets
+// Save save data to storage
 func (b *Blob) Save(ctx context.Context, buf []byte) (err error) {
-	b.lock.Lock()
-	defer b.lock.Unlock()
-
-	// get or create header secret
-	var h blobHeader
-	if h, err = b.headerGet(ctx); err != nil {
-		if k8s_errors.IsNotFound(err) {
-			// reset header
-			h = blobHeader{
-				Name: b.name,
-			}
-			// create secret
-			if err = b.headerCreate(ctx, h); err != nil {
-				return
-			}
-			// in case of error, delete created header secret
-			defer func() {
-				if err == nil {
-					return
-				}
-				_ = b.headerDelete(ctx)
-			}()
-		} else {
-			return
-		}
-	}
-
-	// create new revision
-	oldRevision := h.Revision
-	for {
-		if h.Revision, err = randomRevision(); err != nil {
-			return
-		}
-		if h.Revision != oldRevision {
-			break
-		}
-	}
-
-	chunks := chunkify(buf, b.chunkSize)
-
-	// calculate chunks
-	h.Chunks = len(chunks)
-
-	// in case of error, delete created chunk secret
-	defer func() {
-		if err == nil {
-			return
-		}
-		_ = b.chunkDeleteBySelector(ctx, b.chunkSelectorRevision(h.Revision))
-	}()
-
-	// delete chunk secret
-	if err = b.chunkDeleteBySelector(ctx, b.chunkSelectorRevision(h.Revision)); err != nil {
+	var w *Writer
+	if w, err = b.NewWriter(ctx); err != nil {
 		return
 	}
-
-	// create chunks
-	for i, data := range chunks {
-		if err = b.chunkCreate(ctx, h.Revision, i, data); err != nil {
-			return
-		}
-	}
-
-	// calculate checksum
-	d := md5.New()
-	d.Write(buf)
-	h.Checksum = hex.EncodeToString(d.Sum(nil))
-
-	// patch header service
-	if err = b.headerPatch(ctx, h); err != nil {
+	if _, err = w.Write(buf); err != nil {
+		w.Abort()
 		return
 	}
-
-	// delete old revision
-	_ = b.chunkDeleteBySelector(ctx, b.chunkSelectorNotRevision(h.Revision))
-	return
+	return w.Close()
 }
@@ -0,0 +1,101 @@
+package ezblob
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// latencyStorage simulate round trips to the API server
+type latencyStorage struct {
+	Storage
+	latency time.Duration
+	noList  bool
+}
+
+func (s *latencyStorage) wait() {
+	time.Sleep(s.latency)
+}
+
+func (s *latencyStorage) Get(ctx context.Context, name string) (Object, error) {
+	s.wait()
+	return s.Storage.Get(ctx, name)
+}
+
+func (s *latencyStorage) Create(ctx context.Context, obj Object) error {
+	s.wait()
+	return s.Storage.Create(ctx, obj)
+}
+
+func (s *latencyStorage) Patch(ctx context.Context, name string, data map[string][]byte) error {
+	s.wait()
+	return s.Storage.Patch(ctx, name, data)
+}
+
+func (s *latencyStorage) List(ctx context.Context, sel labels.Selector) ([]Object, error) {
+	s.wait()
+	if s.noList {
+		return nil, errors.New("forbidden")
+	}
+	return s.Storage.List(ctx, sel)
+}
+
+func (s *latencyStorage) DeleteCollection(ctx context.Context, sel labels.Selector) error {
+	s.wait()
+	return s.Storage.DeleteCollection(ctx, sel)
+}
+
+func benchmarkBlob(b *testing.B, opts Options, noList bool) {
+	ctx := context.Background()
+
+	raw := make([]byte, 512*1024)
+	if _, err := rand.Read(raw); err != nil {
+		b.Fatal(err)
+	}
+
+	opts.Name = "ezblob-bench"
+	opts.Storage = &latencyStorage{
+		Storage: NewSecretStorage(newFakeClient(), "default"),
+		latency: time.Millisecond,
+		noList:  noList,
+	}
+	blob, err := New(opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Save", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := blob.Save(ctx, raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Load", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := blob.Load(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkBlobSequential previous behavior, 4 KiB chunks read and written one by one
+func BenchmarkBlobSequential(b *testing.B) {
+	benchmarkBlob(b, Options{ChunkSize: 4096, Concurrency: 1}, true)
+}
+
+// BenchmarkBlobParallel 4 KiB chunks, written concurrently and read with a single List
+func BenchmarkBlobParallel(b *testing.B) {
+	benchmarkBlob(b, Options{ChunkSize: 4096}, false)
+}
+
+// BenchmarkBlobDefault default options
+func BenchmarkBlobDefault(b *testing.B) {
+	benchmarkBlob(b, Options{}, false)
+}
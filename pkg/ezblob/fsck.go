@@ -0,0 +1,213 @@
+package ezblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// DefaultFsckMinAge default minimum age of orphaned chunks to be deleted, younger ones may belong to a
+	// Save in progress
+	DefaultFsckMinAge = 10 * time.Minute
+)
+
+// FsckOptions options of Fsck
+type FsckOptions struct {
+	// Delete delete orphaned revisions
+	Delete bool
+	// MinAge orphaned revisions with any chunk younger than this are reported but never deleted,
+	// defaults to DefaultFsckMinAge
+	MinAge time.Duration
+}
+
+// FsckRevision chunks of a revision that is not referenced by header
+type FsckRevision struct {
+	Revision string
+	Chunks   int
+	// Deleted whether chunks are deleted
+	Deleted bool
+	// Recent whether any chunk is younger than FsckOptions.MinAge
+	Recent bool
+}
+
+// FsckResult result of checking a Blob
+type FsckResult struct {
+	Name string
+	// HeaderMissing whether header is missing, all chunks are orphaned if any
+	HeaderMissing bool
+	// Revision current revision referenced by header
+	Revision string
+	// Chunks number of chunks of current revision
+	Chunks int
+	// Err problem of header or current revision, nil if healthy
+	Err error
+	// Previous previous revision retained for fallback, empty if none
+	Previous string
+	// PreviousErr problem of previous revision, nil if healthy or none
+	PreviousErr error
+	// Orphans revisions not referenced by header
+	Orphans []FsckRevision
+}
+
+// OK returns whether the blob is healthy, or missing entirely, and has no orphaned revision
+func (r FsckResult) OK() bool {
+	return r.Err == nil && r.PreviousErr == nil && len(r.Orphans) == 0
+}
+
+// Fsck verify chunk count and checksums of current and previous revision, and report chunks of revisions not
+// referenced by header, they are deleted if FsckOptions.Delete is set. If header is missing, all chunks are orphaned; if header
+// is invalid, nothing is deleted.
+func (b *Blob) Fsck(ctx context.Context, opts FsckOptions) (result FsckResult, err error) {
+	if opts.MinAge <= 0 {
+		opts.MinAge = DefaultFsckMinAge
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	result.Name = b.name
+
+	var objs []Object
+	if objs, err = b.storage.List(ctx, b.chunkSelector()); err != nil {
+		return
+	}
+
+	revisions := map[string][]Object{}
+	for _, obj := range objs {
+		revision := obj.Labels[LabelKeyRevision]
+		revisions[revision] = append(revisions[revision], obj)
+	}
+
+	var h blobHeader
+	if h, err = b.headerGet(ctx); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			// header exists but is invalid, orphans can not be determined
+			result.Err, err = err, nil
+			return
+		}
+		err = nil
+		result.HeaderMissing = true
+	} else {
+		result.Revision, result.Chunks = h.Revision, h.Chunks
+		result.Err = b.fsckRevision(h.blobRevision, revisions[h.Revision])
+		delete(revisions, h.Revision)
+		if h.Previous.Revision != "" {
+			result.Previous = h.Previous.Revision
+			result.PreviousErr = b.fsckRevision(h.Previous, revisions[h.Previous.Revision])
+			delete(revisions, h.Previous.Revision)
+		}
+	}
+
+	var names []string
+	for revision := range revisions {
+		names = append(names, revision)
+	}
+	sort.Strings(names)
+
+	deadline := time.Now().Add(-opts.MinAge)
+
+	for _, revision := range names {
+		orphan := FsckRevision{Revision: revision, Chunks: len(revisions[revision])}
+		for _, obj := range revisions[revision] {
+			if obj.CreatedAt.After(deadline) {
+				orphan.Recent = true
+			}
+		}
+		if opts.Delete && !orphan.Recent {
+			if err = b.chunkDeleteBySelector(ctx, b.chunkSelectorRevision(revision)); err != nil {
+				return
+			}
+			orphan.Deleted = true
+		}
+		result.Orphans = append(result.Orphans, orphan)
+	}
+
+	return
+}
+
+// fsckRevision verify chunks of a revision referenced by header
+func (b *Blob) fsckRevision(h blobRevision, objs []Object) error {
+	indexes := map[string]int{}
+	for i := 0; i < h.Chunks; i++ {
+		indexes[b.chunkName(h.Revision, i)] = i
+	}
+	chunks := make([][]byte, h.Chunks)
+	found := make([]bool, h.Chunks)
+	var extra []string
+	for _, obj := range objs {
+		index, ok := indexes[obj.Name]
+		if !ok {
+			extra = append(extra, obj.Name)
+			continue
+		}
+		chunks[index], found[index] = obj.Data[KeyData], true
+	}
+	var missing []string
+	for i, ok := range found {
+		if !ok {
+			missing = append(missing, b.chunkName(h.Revision, i))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrChunkMissing, strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		return fmt.Errorf("unexpected chunks of revision '%s': %s", h.Revision, strings.Join(extra, ", "))
+	}
+	var buf []byte
+	for i, chunk := range chunks {
+		if err := h.verifyChunk(i, chunk); err != nil {
+			return err
+		}
+		buf = append(buf, chunk...)
+	}
+	if !verifyChecksum(h.Checksum, buf) {
+		return fmt.Errorf("%w: revision '%s'", ErrChecksumMismatch, h.Revision)
+	}
+	return nil
+}
+
+// FsckStorage run Fsck on every blob with chunks in storage, and the given names, results are sorted by name
+func FsckStorage(ctx context.Context, storage Storage, names []string, opts FsckOptions) (results []FsckResult, err error) {
+	var objs []Object
+	if objs, err = storage.List(ctx, labels.SelectorFromSet(labels.Set{
+		LabelKeyManagedBy: LabelValManagedBy,
+		LabelKeyComponent: LabelValComponent,
+	})); err != nil {
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, obj := range objs {
+		if name := obj.Labels[LabelKeyName]; name != "" {
+			seen[name] = true
+		}
+	}
+	names = nil
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var blob *Blob
+		if blob, err = New(Options{Storage: storage, Name: name}); err != nil {
+			return
+		}
+		var result FsckResult
+		if result, err = blob.Fsck(ctx, opts); err != nil {
+			return
+		}
+		results = append(results, result)
+	}
+	return
+}
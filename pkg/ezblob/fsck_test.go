@@ -0,0 +1,88 @@
+package ezblob
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	blob, err := New(Options{Storage: storage, Name: "ezblob-test", ChunkSize: 10})
+	require.NoError(t, err)
+	require.NoError(t, blob.Save(ctx, []byte("hello, world, hello, world")))
+
+	result, err := blob.Fsck(ctx, FsckOptions{})
+	require.NoError(t, err)
+	require.True(t, result.OK())
+	require.Equal(t, 3, result.Chunks)
+
+	// orphaned revision, e.g. Save killed before patching header
+	for i := 0; i < 2; i++ {
+		require.NoError(t, blob.chunkCreate(ctx, "orphan", i, []byte("x")))
+	}
+	// orphaned blob, e.g. header deleted but chunks not
+	other, err := New(Options{Storage: storage, Name: "ezblob-other"})
+	require.NoError(t, err)
+	require.NoError(t, other.chunkCreate(ctx, "lost", 0, []byte("x")))
+
+	// recent orphans are kept
+	results, err := FsckStorage(ctx, storage, []string{"ezblob-test"}, FsckOptions{Delete: true})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "ezblob-other", results[0].Name)
+	require.True(t, results[0].HeaderMissing)
+	require.Equal(t, []FsckRevision{{Revision: "lost", Chunks: 1, Recent: true}}, results[0].Orphans)
+	require.NoError(t, results[1].Err)
+	require.Equal(t, []FsckRevision{{Revision: "orphan", Chunks: 2, Recent: true}}, results[1].Orphans)
+
+	results, err = FsckStorage(ctx, storage, nil, FsckOptions{Delete: true, MinAge: time.Nanosecond})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.True(t, results[0].Orphans[0].Deleted)
+	require.True(t, results[1].Orphans[0].Deleted)
+
+	results, err = FsckStorage(ctx, storage, nil, FsckOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.True(t, results[0].OK())
+
+	buf, err := blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "hello, world, hello, world", string(buf))
+
+	// corrupted and missing chunks
+	h, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.NoError(t, storage.Patch(ctx, blob.chunkName(h.Revision, 1), map[string][]byte{KeyData: []byte("corrupted")}))
+	result, err = blob.Fsck(ctx, FsckOptions{})
+	require.NoError(t, err)
+	require.True(t, errors.Is(result.Err, ErrChecksumMismatch))
+
+	require.NoError(t, storage.Delete(ctx, blob.chunkName(h.Revision, 2)))
+	result, err = blob.Fsck(ctx, FsckOptions{})
+	require.NoError(t, err)
+	require.True(t, errors.Is(result.Err, ErrChunkMissing))
+	require.False(t, result.OK())
+
+	// previous revision is retained and verified, not orphaned
+	require.NoError(t, blob.Save(ctx, []byte("hello, world")))
+	result, err = blob.Fsck(ctx, FsckOptions{})
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Equal(t, h.Revision, result.Previous)
+	require.True(t, errors.Is(result.PreviousErr, ErrChunkMissing))
+	require.Empty(t, result.Orphans)
+	require.False(t, result.OK())
+
+	require.NoError(t, blob.Save(ctx, []byte("hello, world, again")))
+	result, err = blob.Fsck(ctx, FsckOptions{})
+	require.NoError(t, err)
+	require.True(t, result.OK())
+	require.NotEqual(t, h.Revision, result.Previous)
+}
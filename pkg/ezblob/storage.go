@@ -0,0 +1,157 @@
+package ezblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// Object a header or chunk object in storage
+type Object struct {
+	Name   string
+	Labels map[string]string
+	Data   map[string][]byte
+	// CreatedAt creation time, set by storage, zero if unknown
+	CreatedAt time.Time
+}
+
+func (o Object) clone() Object {
+	out := Object{Name: o.Name, CreatedAt: o.CreatedAt}
+	if o.Labels != nil {
+		out.Labels = map[string]string{}
+		for k, v := range o.Labels {
+			out.Labels[k] = v
+		}
+	}
+	if o.Data != nil {
+		out.Data = map[string][]byte{}
+		for k, v := range o.Data {
+			out.Data[k] = append([]byte(nil), v...)
+		}
+	}
+	return out
+}
+
+// Storage storage of header and chunk objects in a single namespace, implementations must return errors
+// matching ErrNotFound for missing objects and ErrAlreadyExists for existing objects
+type Storage interface {
+	// Get get an object by name
+	Get(ctx context.Context, name string) (Object, error)
+	// Create create an object
+	Create(ctx context.Context, obj Object) error
+	// Patch replace the given data keys of an existing object, other keys are kept
+	Patch(ctx context.Context, name string, data map[string][]byte) error
+	// Delete delete an object by name
+	Delete(ctx context.Context, name string) error
+	// List list objects matching the label selector
+	List(ctx context.Context, sel labels.Selector) ([]Object, error)
+	// DeleteCollection delete all objects matching the label selector
+	DeleteCollection(ctx context.Context, sel labels.Selector) error
+}
+
+type memoryStorage struct {
+	lock    sync.Locker
+	objects map[string]Object
+}
+
+// NewMemoryStorage create an in-memory Storage, mainly for testing
+func NewMemoryStorage() Storage {
+	return &memoryStorage{
+		lock:    &sync.Mutex{},
+		objects: map[string]Object{},
+	}
+}
+
+func (s *memoryStorage) Get(ctx context.Context, name string) (obj Object, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var ok bool
+	if obj, ok = s.objects[name]; !ok {
+		err = fmt.Errorf("ezblob: object '%s': %w", name, ErrNotFound)
+		return
+	}
+	obj = obj.clone()
+	return
+}
+
+func (s *memoryStorage) Create(ctx context.Context, obj Object) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.objects[obj.Name]; ok {
+		err = fmt.Errorf("ezblob: object '%s': %w", obj.Name, ErrAlreadyExists)
+		return
+	}
+	obj = obj.clone()
+	obj.CreatedAt = time.Now()
+	s.objects[obj.Name] = obj
+	return
+}
+
+func (s *memoryStorage) Patch(ctx context.Context, name string, data map[string][]byte) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, ok := s.objects[name]
+	if !ok {
+		err = fmt.Errorf("ezblob: object '%s': %w", name, ErrNotFound)
+		return
+	}
+	if obj.Data == nil {
+		obj.Data = map[string][]byte{}
+	}
+	for k, v := range data {
+		obj.Data[k] = append([]byte(nil), v...)
+	}
+	s.objects[name] = obj
+	return
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, name string) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.objects[name]; !ok {
+		err = fmt.Errorf("ezblob: object '%s': %w", name, ErrNotFound)
+		return
+	}
+	delete(s.objects, name)
+	return
+}
+
+func (s *memoryStorage) List(ctx context.Context, sel labels.Selector) (out []Object, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, obj := range s.objects {
+		if sel.Matches(labels.Set(obj.Labels)) {
+			out = append(out, obj.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return
+}
+
+func (s *memoryStorage) DeleteCollection(ctx context.Context, sel labels.Selector) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, obj := range s.objects {
+		if sel.Matches(labels.Set(obj.Labels)) {
+			delete(s.objects, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,156 @@
+package ezblob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// wrapKubeError wrap kubernetes NotFound and AlreadyExists errors with ErrNotFound and ErrAlreadyExists
+func wrapKubeError(err error) error {
+	if k8s_errors.IsNotFound(err) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if k8s_errors.IsAlreadyExists(err) {
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	}
+	return err
+}
+
+type secretStorage struct {
+	api clientcorev1.SecretInterface
+}
+
+// NewSecretStorage create a Storage backed by Secrets in namespace
+func NewSecretStorage(client kubernetes.Interface, namespace string) Storage {
+	return &secretStorage{api: client.CoreV1().Secrets(namespace)}
+}
+
+func (s *secretStorage) Get(ctx context.Context, name string) (obj Object, err error) {
+	var secret *corev1.Secret
+	if secret, err = s.api.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	obj = Object{Name: secret.Name, Labels: secret.Labels, Data: secret.Data, CreatedAt: secret.CreationTimestamp.Time}
+	return
+}
+
+func (s *secretStorage) Create(ctx context.Context, obj Object) (err error) {
+	if _, err = s.api.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   obj.Name,
+			Labels: obj.Labels,
+		},
+		Data: obj.Data,
+		Type: corev1.SecretTypeOpaque,
+	}, metav1.CreateOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	return
+}
+
+func (s *secretStorage) Patch(ctx context.Context, name string, data map[string][]byte) (err error) {
+	var buf []byte
+	if buf, err = json.Marshal(corev1.Secret{Data: data}); err != nil {
+		return
+	}
+	if _, err = s.api.Patch(ctx, name, types.StrategicMergePatchType, buf, metav1.PatchOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	return
+}
+
+func (s *secretStorage) Delete(ctx context.Context, name string) error {
+	return wrapKubeError(s.api.Delete(ctx, name, metav1.DeleteOptions{}))
+}
+
+func (s *secretStorage) List(ctx context.Context, sel labels.Selector) (out []Object, err error) {
+	var list *corev1.SecretList
+	if list, err = s.api.List(ctx, metav1.ListOptions{LabelSelector: sel.String()}); err != nil {
+		return
+	}
+	for _, secret := range list.Items {
+		out = append(out, Object{Name: secret.Name, Labels: secret.Labels, Data: secret.Data, CreatedAt: secret.CreationTimestamp.Time})
+	}
+	return
+}
+
+func (s *secretStorage) DeleteCollection(ctx context.Context, sel labels.Selector) error {
+	return s.api.DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: sel.String()})
+}
+
+type configMapStorage struct {
+	api clientcorev1.ConfigMapInterface
+}
+
+// NewConfigMapStorage create a Storage backed by ConfigMaps in namespace, data is stored in 'binaryData', it
+// requires no permission on Secrets and does not show up in secret scanners
+func NewConfigMapStorage(client kubernetes.Interface, namespace string) Storage {
+	return &configMapStorage{api: client.CoreV1().ConfigMaps(namespace)}
+}
+
+func (s *configMapStorage) Get(ctx context.Context, name string) (obj Object, err error) {
+	var cm *corev1.ConfigMap
+	if cm, err = s.api.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	obj = Object{Name: cm.Name, Labels: cm.Labels, Data: cm.BinaryData, CreatedAt: cm.CreationTimestamp.Time}
+	return
+}
+
+func (s *configMapStorage) Create(ctx context.Context, obj Object) (err error) {
+	if _, err = s.api.Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   obj.Name,
+			Labels: obj.Labels,
+		},
+		BinaryData: obj.Data,
+	}, metav1.CreateOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	return
+}
+
+func (s *configMapStorage) Patch(ctx context.Context, name string, data map[string][]byte) (err error) {
+	var buf []byte
+	if buf, err = json.Marshal(corev1.ConfigMap{BinaryData: data}); err != nil {
+		return
+	}
+	if _, err = s.api.Patch(ctx, name, types.StrategicMergePatchType, buf, metav1.PatchOptions{}); err != nil {
+		err = wrapKubeError(err)
+		return
+	}
+	return
+}
+
+func (s *configMapStorage) Delete(ctx context.Context, name string) error {
+	return wrapKubeError(s.api.Delete(ctx, name, metav1.DeleteOptions{}))
+}
+
+func (s *configMapStorage) List(ctx context.Context, sel labels.Selector) (out []Object, err error) {
+	var list *corev1.ConfigMapList
+	if list, err = s.api.List(ctx, metav1.ListOptions{LabelSelector: sel.String()}); err != nil {
+		return
+	}
+	for _, cm := range list.Items {
+		out = append(out, Object{Name: cm.Name, Labels: cm.Labels, Data: cm.BinaryData, CreatedAt: cm.CreationTimestamp.Time})
+	}
+	return
+}
+
+func (s *configMapStorage) DeleteCollection(ctx context.Context, sel labels.Selector) error {
+	return s.api.DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: sel.String()})
+}
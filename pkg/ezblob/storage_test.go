@@ -0,0 +1,269 @@
+package ezblob
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeClient create a fake clientset, with support of DeleteCollection which the default tracker lacks
+func newFakeClient() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("delete-collection", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		dc := action.(k8stesting.DeleteCollectionAction)
+		gvr := dc.GetResource()
+		var kind string
+		switch gvr.Resource {
+		case "secrets":
+			kind = "Secret"
+		case "configmaps":
+			kind = "ConfigMap"
+		default:
+			return
+		}
+		var list runtime.Object
+		if list, err = client.Tracker().List(gvr, schema.GroupVersionKind{Version: "v1", Kind: kind}, dc.GetNamespace()); err != nil {
+			return
+		}
+		var items []runtime.Object
+		if items, err = meta.ExtractList(list); err != nil {
+			return
+		}
+		sel := dc.GetListRestrictions().Labels
+		for _, item := range items {
+			obj := item.(metav1.Object)
+			if !sel.Matches(labels.Set(obj.GetLabels())) {
+				continue
+			}
+			if err = client.Tracker().Delete(gvr, dc.GetNamespace(), obj.GetName()); err != nil {
+				return
+			}
+		}
+		handled = true
+		return
+	})
+	return client
+}
+
+func TestStorages(t *testing.T) {
+	client := newFakeClient()
+
+	for name, storage := range map[string]Storage{
+		"memory":    NewMemoryStorage(),
+		"secret":    NewSecretStorage(client, "default"),
+		"configmap": NewConfigMapStorage(client, "default"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := storage.Get(ctx, "missing")
+			require.True(t, errors.Is(err, ErrNotFound))
+
+			blob, err := New(Options{
+				Storage:   storage,
+				Name:      "ezblob-test",
+				Namespace: "default",
+				ChunkSize: 128,
+			})
+			require.NoError(t, err)
+
+			_, err = blob.Load(ctx)
+			require.Equal(t, ErrNotFound, err)
+
+			raw := make([]byte, 755)
+			_, err = rand.Read(raw)
+			require.NoError(t, err)
+			require.NoError(t, blob.Save(ctx, raw))
+
+			buf, err := blob.Load(ctx)
+			require.NoError(t, err)
+			require.Equal(t, raw, buf)
+
+			_, err = rand.Read(raw)
+			require.NoError(t, err)
+			require.NoError(t, blob.Save(ctx, raw))
+
+			buf, err = blob.Load(ctx)
+			require.NoError(t, err)
+			require.Equal(t, raw, buf)
+
+			// only chunks of current and previous revision are kept
+			chunks, err := storage.List(ctx, blob.chunkSelector())
+			require.NoError(t, err)
+			require.Len(t, chunks, 12)
+
+			err = storage.Create(ctx, Object{Name: "ezblob-test"})
+			require.True(t, errors.Is(err, ErrAlreadyExists))
+
+			require.NoError(t, blob.Delete(ctx))
+			chunks, err = storage.List(ctx, blob.chunkSelector())
+			require.NoError(t, err)
+			require.Empty(t, chunks)
+			_, err = blob.Load(ctx)
+			require.Equal(t, ErrNotFound, err)
+		})
+	}
+}
+
+// countingStorage count calls of Get and List, optionally failing List
+type countingStorage struct {
+	Storage
+	gets     atomic.Int64
+	lists    atomic.Int64
+	failList bool
+}
+
+func (s *countingStorage) Get(ctx context.Context, name string) (Object, error) {
+	s.gets.Add(1)
+	return s.Storage.Get(ctx, name)
+}
+
+func (s *countingStorage) List(ctx context.Context, sel labels.Selector) ([]Object, error) {
+	s.lists.Add(1)
+	if s.failList {
+		return nil, errors.New("forbidden")
+	}
+	return s.Storage.List(ctx, sel)
+}
+
+func TestBlobChunksGet(t *testing.T) {
+	ctx := context.Background()
+	storage := &countingStorage{Storage: NewSecretStorage(newFakeClient(), "default")}
+
+	blob, err := New(Options{Storage: storage, Name: "ezblob-test", ChunkSize: 100, Concurrency: 3})
+	require.NoError(t, err)
+
+	raw := make([]byte, 1050)
+	_, err = rand.Read(raw)
+	require.NoError(t, err)
+	require.NoError(t, blob.Save(ctx, raw))
+
+	// header and a single List
+	storage.gets.Store(0)
+	storage.lists.Store(0)
+	buf, err := blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, raw, buf)
+	require.Equal(t, int64(1), storage.gets.Load())
+	require.Equal(t, int64(1), storage.lists.Load())
+
+	// fallback to Get
+	storage.failList = true
+	storage.gets.Store(0)
+	buf, err = blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, raw, buf)
+	require.Equal(t, int64(12), storage.gets.Load())
+
+	// missing chunk
+	h, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.NoError(t, storage.Delete(ctx, blob.chunkName(h.Revision, 5)))
+	_, err = blob.Load(ctx)
+	require.True(t, errors.Is(err, ErrChunkMissing))
+
+	_, err = New(Options{Storage: storage, Name: "ezblob-test", ChunkSize: MaxChunkSize + 1})
+	require.Error(t, err)
+}
+
+func TestBlobFallback(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	var fallbacks []string
+	blob, err := New(Options{
+		Storage:   storage,
+		Name:      "ezblob-test",
+		ChunkSize: 10,
+		OnFallback: func(revision string, previous string, err error) {
+			require.True(t, IsCorrupted(err))
+			fallbacks = append(fallbacks, revision+"->"+previous)
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, blob.Save(ctx, []byte("hello, world, version 1")))
+	first, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.Empty(t, first.Previous.Revision)
+	require.Len(t, first.ChunkChecksums, 3)
+
+	require.NoError(t, blob.Save(ctx, []byte("hello, world, version 2")))
+	h, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first.blobRevision, h.Previous)
+
+	// a corrupted chunk is detected by its own checksum
+	require.NoError(t, storage.Patch(ctx, blob.chunkName(h.Revision, 1), map[string][]byte{KeyData: []byte("corrupted!")}))
+	_, err = blob.chunksGet(ctx, h.blobRevision)
+	require.True(t, errors.Is(err, ErrChecksumMismatch))
+	require.Contains(t, err.Error(), "chunk 1")
+
+	buf, err := blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "hello, world, version 1", string(buf))
+	require.Equal(t, []string{h.Revision + "->" + first.Revision}, fallbacks)
+
+	// the corrupted revision is not kept as previous revision
+	require.NoError(t, blob.Save(ctx, []byte("hello, world, version 3")))
+	third, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first.blobRevision, third.Previous)
+	chunks, err := storage.List(ctx, blob.chunkSelector())
+	require.NoError(t, err)
+	require.Len(t, chunks, 6)
+
+	buf, err = blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "hello, world, version 3", string(buf))
+
+	// both revisions corrupted
+	require.NoError(t, storage.Delete(ctx, blob.chunkName(third.Revision, 0)))
+	require.NoError(t, storage.Delete(ctx, blob.chunkName(first.Revision, 0)))
+	_, err = blob.Load(ctx)
+	require.True(t, errors.Is(err, ErrChunkMissing))
+	require.Len(t, fallbacks, 2)
+}
+
+func TestBlobVerifyRevision(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	blob, err := New(Options{Storage: storage, Name: "ezblob-test", ChunkSize: 10, Concurrency: 2})
+	require.NoError(t, err)
+
+	raw := make([]byte, 75)
+	_, err = rand.Read(raw)
+	require.NoError(t, err)
+	require.NoError(t, blob.Save(ctx, raw))
+
+	h, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 8, h.Chunks)
+	require.NoError(t, blob.verifyRevision(ctx, h.blobRevision))
+
+	// checksum over all chunks
+	rev := h.blobRevision
+	rev.Checksum = checksum([]byte("other"))
+	require.True(t, errors.Is(blob.verifyRevision(ctx, rev), ErrChecksumMismatch))
+
+	// checksum of a single chunk
+	require.NoError(t, storage.Patch(ctx, blob.chunkName(h.Revision, 7), map[string][]byte{KeyData: []byte("corrupted")}))
+	err = blob.verifyRevision(ctx, h.blobRevision)
+	require.True(t, errors.Is(err, ErrChecksumMismatch))
+	require.Contains(t, err.Error(), "chunk 7")
+
+	require.NoError(t, storage.Delete(ctx, blob.chunkName(h.Revision, 3)))
+	require.True(t, errors.Is(blob.verifyRevision(ctx, h.blobRevision), ErrChunkMissing))
+}
@@ -0,0 +1,336 @@
+package ezblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/yankeguo/ezdeploy/pkg/ezsync"
+)
+
+var (
+	errReaderClosed = errors.New("ezblob: reader closed")
+	errWriterClosed = errors.New("ezblob: writer closed")
+)
+
+// Reader streams data of a revision, chunks are fetched lazily and verified as they are read
+type Reader struct {
+	blob  *Blob
+	ctx   context.Context
+	rev   blobRevision
+	hash  hash.Hash
+	index int
+	buf   []byte
+	err   error
+}
+
+// NewReader open a Reader of the current revision, returns ErrNotFound if the blob does not exist.
+//
+// Each chunk is verified before returned if the header has checksums of chunks, and the checksum of all data is
+// verified when the last chunk is consumed. Read returns ErrChecksumMismatch instead of io.EOF if it does not
+// match, thus data must not be trusted until io.EOF is returned. A concurrent Save may delete chunks of the
+// revision being read, which fails the Reader with ErrChunkMissing.
+//
+// If the Reader fails with an error satisfying IsCorrupted, NewFallbackReader can be used to read the previous
+// revision.
+func (b *Blob) NewReader(ctx context.Context) (r *Reader, err error) {
+	var h blobHeader
+	if h, err = b.headerGet(ctx); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = ErrNotFound
+		}
+		return
+	}
+	r = b.newReader(ctx, h.blobRevision)
+	return
+}
+
+// NewFallbackReader open a Reader of the previous revision, after the current revision is found corrupted with
+// cause, Options.OnFallback is invoked. cause is returned if there is no previous revision.
+func (b *Blob) NewFallbackReader(ctx context.Context, cause error) (r *Reader, err error) {
+	var h blobHeader
+	if h, err = b.headerGet(ctx); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = ErrNotFound
+		}
+		return
+	}
+	if !b.fallback(h, cause) {
+		err = cause
+		return
+	}
+	r = b.newReader(ctx, h.Previous)
+	return
+}
+
+func (b *Blob) newReader(ctx context.Context, rev blobRevision) *Reader {
+	return &Reader{
+		blob: b,
+		ctx:  ctx,
+		rev:  rev,
+		hash: newChecksumHash(rev.Checksum),
+	}
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.index >= r.rev.Chunks {
+			if checksumMatches(r.rev.Checksum, r.hash) {
+				r.err = io.EOF
+				if r.blob.onChunks != nil {
+					r.blob.onChunks("load", r.rev.Chunks)
+				}
+			} else {
+				r.err = fmt.Errorf("%w: revision '%s'", ErrChecksumMismatch, r.rev.Revision)
+			}
+			continue
+		}
+		var chunk []byte
+		if chunk, r.err = r.blob.chunkGet(r.ctx, r.rev.Revision, r.index); r.err != nil {
+			continue
+		}
+		if r.err = r.rev.verifyChunk(r.index, chunk); r.err != nil {
+			continue
+		}
+		r.hash.Write(chunk)
+		r.buf = chunk
+		r.index++
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return
+}
+
+// Err returns the error failing the Reader, nil if none or io.EOF
+func (r *Reader) Err() error {
+	if r.err == io.EOF || r.err == errReaderClosed {
+		return nil
+	}
+	return r.err
+}
+
+// Close implements io.Closer
+func (r *Reader) Close() error {
+	r.buf = nil
+	r.err = errReaderClosed
+	return nil
+}
+
+// Writer streams data into a new revision, full chunks are uploaded concurrently while writing, and the header
+// is switched to the new revision on Close
+type Writer struct {
+	blob    *Blob
+	ctx     context.Context
+	h       blobHeader
+	created bool
+	// previous revision kept as a fallback
+	previous blobRevision
+	hash     hash.Hash
+	buf      []byte
+	pg       *ezsync.ParaGroup
+
+	errLock sync.Locker
+	err     error
+	closed  bool
+}
+
+// NewWriter open a Writer of a new revision, the header is created if missing.
+//
+// The Writer holds the lock of Blob, it must be finished with either Close or Abort.
+func (b *Blob) NewWriter(ctx context.Context) (w *Writer, err error) {
+	b.lock.Lock()
+	defer func() {
+		if err != nil {
+			b.lock.Unlock()
+		}
+	}()
+
+	w = &Writer{
+		blob:    b,
+		ctx:     ctx,
+		hash:    newChecksumHash(""),
+		pg:      ezsync.NewParaGroup(b.para),
+		errLock: &sync.Mutex{},
+	}
+
+	// get or create header
+	if w.h, err = b.headerGet(ctx); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			w.h = blobHeader{
+				Name: b.name,
+			}
+			if err = b.headerCreate(ctx, w.h); err != nil {
+				return
+			}
+			w.created = true
+		} else {
+			return
+		}
+	}
+
+	// in case of error, delete created header
+	defer func() {
+		if err != nil && w.created {
+			_ = b.headerDelete(ctx)
+		}
+	}()
+
+	// the current revision is kept as previous, unless it's corrupted
+	if b.isCorrupted(w.h.Revision) {
+		w.previous = w.h.Previous
+	} else {
+		w.previous = w.h.blobRevision
+	}
+
+	// create new revision
+	oldRevision := w.h.Revision
+	for {
+		if w.h.Revision, err = randomRevision(); err != nil {
+			return
+		}
+		if w.h.Revision != oldRevision {
+			break
+		}
+	}
+	w.h.Chunks = 0
+	w.h.ChunkChecksums = nil
+
+	// delete chunks of the same revision
+	if err = b.chunkDeleteBySelector(ctx, b.chunkSelectorRevision(w.h.Revision)); err != nil {
+		return
+	}
+	return
+}
+
+func (w *Writer) setErr(err error) {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *Writer) getErr() error {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+	return w.err
+}
+
+// upload create a chunk in background, with bounded concurrency
+func (w *Writer) upload(chunk []byte) {
+	index := w.h.Chunks
+	w.h.Chunks++
+	w.h.ChunkChecksums = append(w.h.ChunkChecksums, checksum(chunk))
+
+	w.pg.Mark()
+	w.pg.Take()
+	go func() {
+		defer w.pg.Done()
+		if w.getErr() != nil {
+			return
+		}
+		if err := w.blob.chunkCreate(w.ctx, w.h.Revision, index, chunk); err != nil {
+			w.setErr(err)
+		}
+	}()
+}
+
+// Write implements io.Writer, errors of uploading previous chunks are returned
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if err = w.getErr(); err != nil {
+		return
+	}
+	w.hash.Write(p)
+	w.buf = append(w.buf, p...)
+	if full := len(w.buf) / w.blob.chunkSize * w.blob.chunkSize; full > 0 {
+		for _, chunk := range chunkify(w.buf[:full], w.blob.chunkSize) {
+			w.upload(chunk)
+		}
+		w.buf = append([]byte(nil), w.buf[full:]...)
+	}
+	n = len(p)
+	return
+}
+
+// commit verify the new revision by reading back, then patch header and delete revisions other than the new
+// and previous ones
+func (w *Writer) commit() (err error) {
+	if err = w.blob.verifyRevision(w.ctx, w.h.blobRevision); err != nil {
+		err = fmt.Errorf("ezblob: failed to verify written revision: %w", err)
+		return
+	}
+	if err = w.blob.headerPatch(w.ctx, w.h); err != nil {
+		return
+	}
+	_ = w.blob.chunkDeleteBySelector(w.ctx, w.blob.chunkSelectorNotRevisions(w.h.Revision, w.h.Previous.Revision))
+	return
+}
+
+// finish wait for uploads and release the lock, chunks of the new revision and created header are deleted on
+// error or abort
+func (w *Writer) finish(err error) error {
+	w.closed = true
+	w.pg.Wait()
+	defer w.blob.lock.Unlock()
+
+	if err == nil {
+		err = w.getErr()
+	}
+	if err == nil {
+		return nil
+	}
+	_ = w.blob.chunkDeleteBySelector(w.ctx, w.blob.chunkSelectorRevision(w.h.Revision))
+	if w.created {
+		_ = w.blob.headerDelete(w.ctx)
+	}
+	return err
+}
+
+// Abort discard written data, the current revision is kept
+func (w *Writer) Abort() {
+	if w.closed {
+		return
+	}
+	_ = w.finish(errWriterClosed)
+}
+
+// Close implements io.Closer, it uploads remaining data, reads back and verifies the new revision, switches header
+// to it, and deletes other revisions except the previous one
+func (w *Writer) Close() (err error) {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	if len(w.buf) > 0 {
+		w.upload(w.buf)
+		w.buf = nil
+	}
+
+	// wait for uploads
+	w.pg.Wait()
+
+	if err = w.getErr(); err == nil {
+		w.h.Checksum = checksumSum(w.hash)
+		w.h.Previous = w.previous
+		err = w.commit()
+	}
+
+	if err = w.finish(err); err != nil {
+		return
+	}
+
+	if w.blob.onChunks != nil {
+		w.blob.onChunks("save", w.h.Chunks)
+	}
+	return
+}
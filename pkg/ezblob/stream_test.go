@@ -0,0 +1,105 @@
+package ezblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	var ops []string
+	blob, err := New(Options{
+		Storage:     storage,
+		Name:        "ezblob-test",
+		ChunkSize:   100,
+		Concurrency: 2,
+		OnChunks: func(op string, chunks int) {
+			ops = append(ops, op)
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = blob.NewReader(ctx)
+	require.Equal(t, ErrNotFound, err)
+
+	raw := make([]byte, 1234)
+	_, err = rand.Read(raw)
+	require.NoError(t, err)
+
+	w, err := blob.NewWriter(ctx)
+	require.NoError(t, err)
+	for _, part := range [][]byte{raw[:7], raw[7:300], raw[300:301], raw[301:]} {
+		n, err := w.Write(part)
+		require.NoError(t, err)
+		require.Equal(t, len(part), n)
+	}
+	require.NoError(t, w.Close())
+	require.Error(t, w.Close())
+
+	// compatible with Load
+	buf, err := blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, raw, buf)
+
+	r, err := blob.NewReader(ctx)
+	require.NoError(t, err)
+	require.NoError(t, iotest.TestReader(r, raw))
+	require.NoError(t, r.Close())
+
+	require.Equal(t, []string{"save", "load", "load"}, ops)
+
+	// abort keeps current revision
+	w, err = blob.NewWriter(ctx)
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("a"), 250))
+	require.NoError(t, err)
+	w.Abort()
+
+	buf, err = blob.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, raw, buf)
+
+	chunks, err := storage.List(ctx, blob.chunkSelector())
+	require.NoError(t, err)
+	require.Len(t, chunks, 13)
+
+	// corrupted chunk
+	h, err := blob.headerGet(ctx)
+	require.NoError(t, err)
+	require.NoError(t, storage.Patch(ctx, blob.chunkName(h.Revision, 3), map[string][]byte{KeyData: []byte("corrupted")}))
+
+	r, err = blob.NewReader(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.True(t, errors.Is(err, ErrChecksumMismatch))
+}
+
+func TestStreamAbortNew(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	blob, err := New(Options{Storage: storage, Name: "ezblob-test", ChunkSize: 100})
+	require.NoError(t, err)
+
+	w, err := blob.NewWriter(ctx)
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("a"), 250))
+	require.NoError(t, err)
+	w.Abort()
+
+	// header created by writer is deleted
+	_, err = blob.Load(ctx)
+	require.Equal(t, ErrNotFound, err)
+	chunks, err := storage.List(ctx, blob.chunkSelector())
+	require.NoError(t, err)
+	require.Empty(t, chunks)
+}
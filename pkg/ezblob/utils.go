@@ -1,11 +1,54 @@
 package ezblob
 
 import (
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
+	"hash"
 	"strings"
 )
 
+const (
+	checksumPrefixSHA256 = "sha256:"
+)
+
+// checksum returns versioned SHA-256 checksum of buf
+func checksum(buf []byte) string {
+	h := sha256.Sum256(buf)
+	return checksumPrefixSHA256 + hex.EncodeToString(h[:])
+}
+
+// verifyChecksum verify buf against a versioned SHA-256 checksum, or a legacy MD5 checksum without prefix
+func verifyChecksum(expected string, buf []byte) bool {
+	h := newChecksumHash(expected)
+	h.Write(buf)
+	return checksumMatches(expected, h)
+}
+
+// newChecksumHash returns a hash for verifying data against expected, MD5 for legacy checksums, SHA-256 otherwise
+func newChecksumHash(expected string) hash.Hash {
+	if expected != "" && !strings.HasPrefix(expected, checksumPrefixSHA256) {
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// checksumSum returns versioned checksum of a hash created by newChecksumHash
+func checksumSum(h hash.Hash) string {
+	sum := hex.EncodeToString(h.Sum(nil))
+	if h.Size() == sha256.Size {
+		return checksumPrefixSHA256 + sum
+	}
+	return sum
+}
+
+// checksumMatches returns whether the hash created by newChecksumHash(expected) matches expected
+func checksumMatches(expected string, h hash.Hash) bool {
+	return expected == checksumSum(h)
+}
+
 func randomRevision() (s string, err error) {
 	buf := make([]byte, 4)
 	if _, err = rand.Read(buf); err != nil {
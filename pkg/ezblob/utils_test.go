@@ -20,3 +20,12 @@ func TestChunkify(t *testing.T) {
 	v = chunkify([]byte{}, 4)
 	require.Nil(t, v)
 }
+
+func TestChecksum(t *testing.T) {
+	buf := []byte("hello")
+	require.Equal(t, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", checksum(buf))
+	require.True(t, verifyChecksum(checksum(buf), buf))
+	require.True(t, verifyChecksum("5d41402abc4b2a76b9719d911017c592", buf))
+	require.False(t, verifyChecksum("5d41402abc4b2a76b9719d911017c592", []byte("world")))
+	require.False(t, verifyChecksum(checksum(buf), []byte("world")))
+}
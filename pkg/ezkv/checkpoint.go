@@ -0,0 +1,94 @@
+package ezkv
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultCheckpointInterval = time.Second * 5
+)
+
+// CheckpointOptions options of Checkpointer
+type CheckpointOptions struct {
+	// Interval minimum interval between two saves, defaults to DefaultCheckpointInterval
+	Interval time.Duration
+	// OnSave optional callback, invoked after each attempted save
+	OnSave func(duration time.Duration, err error)
+}
+
+// Checkpointer saves a KV in background when requested, requests arriving while waiting or saving are
+// coalesced into a single following save
+type Checkpointer struct {
+	save     func(ctx context.Context) (saved bool, err error)
+	interval time.Duration
+	onSave   func(duration time.Duration, err error)
+
+	requests chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewCheckpointer create a Checkpointer saving modifications of db, Close must be called to stop it
+func (db *KV) NewCheckpointer(ctx context.Context, opts CheckpointOptions) *Checkpointer {
+	return newCheckpointer(ctx, db.SaveIfDirty, opts)
+}
+
+func newCheckpointer(ctx context.Context, save func(ctx context.Context) (bool, error), opts CheckpointOptions) *Checkpointer {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCheckpointInterval
+	}
+	c := &Checkpointer{
+		save:     save,
+		interval: opts.Interval,
+		onSave:   opts.OnSave,
+		requests: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run(ctx)
+	return c
+}
+
+func (c *Checkpointer) run(ctx context.Context) {
+	defer close(c.done)
+
+	var last time.Time
+
+	for {
+		select {
+		case <-c.requests:
+		case <-c.stop:
+			return
+		}
+
+		if wait := c.interval - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.stop:
+				return
+			}
+		}
+
+		last = time.Now()
+		saved, err := c.save(ctx)
+		if c.onSave != nil && (saved || err != nil) {
+			c.onSave(time.Since(last), err)
+		}
+	}
+}
+
+// Request request a save without blocking
+func (c *Checkpointer) Request() {
+	select {
+	case c.requests <- struct{}{}:
+	default:
+	}
+}
+
+// Close stop the Checkpointer and wait for the running save, pending requests are dropped, a final
+// Save is expected from caller
+func (c *Checkpointer) Close() {
+	close(c.stop)
+	<-c.done
+}
@@ -0,0 +1,42 @@
+package ezkv
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointer(t *testing.T) {
+	var saves int32
+
+	c := newCheckpointer(context.Background(), func(ctx context.Context) (bool, error) {
+		atomic.AddInt32(&saves, 1)
+		time.Sleep(time.Millisecond * 50)
+		return true, nil
+	}, CheckpointOptions{Interval: time.Millisecond * 100})
+
+	// a burst of requests is coalesced
+	for i := 0; i < 20; i++ {
+		c.Request()
+	}
+	time.Sleep(time.Millisecond * 30)
+	for i := 0; i < 20; i++ {
+		c.Request()
+	}
+	time.Sleep(time.Millisecond * 300)
+	c.Close()
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&saves))
+}
+
+func TestCheckpointerClose(t *testing.T) {
+	c := newCheckpointer(context.Background(), func(ctx context.Context) (bool, error) {
+		t.Fatal("should not save after close")
+		return false, nil
+	}, CheckpointOptions{Interval: time.Hour})
+	c.Close()
+	c.Request()
+}
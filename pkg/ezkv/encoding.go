@@ -0,0 +1,127 @@
+package ezkv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FormatVersion version of the encoding written, version 1 is the legacy gob encoding of bare checksums
+	FormatVersion = 2
+
+	// formatMagic prefix of the header line, followed by format version
+	formatMagic = "ezkv/"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("ezkv: unsupported format")
+
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// document the encoded content following the header line, JSON compressed with gzip
+type document struct {
+	Records map[string]Record `json:"records"`
+}
+
+// encode write records into w, as a header line 'ezkv/<version>' and a document
+func encode(w io.Writer, records map[string]Record) (err error) {
+	if _, err = io.WriteString(w, formatMagic+strconv.Itoa(FormatVersion)+"\n"); err != nil {
+		return
+	}
+	gw := gzip.NewWriter(w)
+	if err = json.NewEncoder(gw).Encode(document{Records: records}); err != nil {
+		return
+	}
+	if err = gw.Close(); err != nil {
+		return
+	}
+	return
+}
+
+// decode read records from r, in current encoding or the legacy gob encoding, r is drained to the end
+func decode(r io.Reader) (records map[string]Record, err error) {
+	br := bufio.NewReader(r)
+
+	var head []byte
+	if head, err = br.Peek(len(gzipMagic)); err != nil {
+		return
+	}
+
+	if bytes.Equal(head, gzipMagic) {
+		records, err = decodeLegacy(br)
+	} else {
+		records, err = decodeDocument(br)
+	}
+	if err != nil {
+		return
+	}
+
+	if _, err = io.Copy(io.Discard, br); err != nil {
+		return
+	}
+	return
+}
+
+// decodeLegacy read gob encoded checksums compressed with gzip, written by previous versions
+func decodeLegacy(r io.Reader) (records map[string]Record, err error) {
+	var gr *gzip.Reader
+	if gr, err = gzip.NewReader(r); err != nil {
+		return
+	}
+
+	data := map[string]string{}
+	if err = gob.NewDecoder(gr).Decode(&data); err != nil {
+		return
+	}
+
+	records = make(map[string]Record, len(data))
+	for k, v := range data {
+		records[k] = Record{Checksum: v}
+	}
+	return
+}
+
+// decodeDocument read the header line and the document following
+func decodeDocument(r *bufio.Reader) (records map[string]Record, err error) {
+	var line string
+	if line, err = r.ReadString('\n'); err != nil {
+		err = fmt.Errorf("%w: missing header line", ErrUnsupportedFormat)
+		return
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	if !strings.HasPrefix(line, formatMagic) {
+		err = fmt.Errorf("%w: invalid header line '%s'", ErrUnsupportedFormat, line)
+		return
+	}
+	var version int
+	if version, err = strconv.Atoi(strings.TrimPrefix(line, formatMagic)); err != nil || version != FormatVersion {
+		err = fmt.Errorf("%w: version '%s', upgrade ezdeploy to read it", ErrUnsupportedFormat, strings.TrimPrefix(line, formatMagic))
+		return
+	}
+
+	var gr *gzip.Reader
+	if gr, err = gzip.NewReader(r); err != nil {
+		return
+	}
+
+	var doc document
+	if err = json.NewDecoder(gr).Decode(&doc); err != nil {
+		return
+	}
+
+	records = doc.Records
+	if records == nil {
+		records = map[string]Record{}
+	}
+	return
+}
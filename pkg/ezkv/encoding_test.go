@@ -0,0 +1,84 @@
+package ezkv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezdeploy/pkg/ezblob"
+)
+
+func TestEncoding(t *testing.T) {
+	records := map[string]Record{
+		"default::Deployment::demo": {
+			Checksum:  "sha256:0123",
+			Path:      "default/demo.yaml",
+			AppliedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			RunID:     "20240102030405-abcd",
+			Version:   "v1.2.3",
+			GitCommit: "deadbeef",
+			Mode:      ModeApply,
+			Owner:     "system:serviceaccount:default:deployer",
+		},
+		"default::Helm::demo": {Checksum: "sha256:4567", Mode: ModeRelease},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, encode(buf, records))
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("ezkv/2\n")))
+
+	out, err := decode(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, records, out)
+
+	out, err = decode(bytes.NewReader([]byte("ezkv/2\n")))
+	require.Error(t, err)
+	require.Nil(t, out)
+
+	_, err = decode(bytes.NewReader([]byte("ezkv/3\nwhatever")))
+	require.True(t, errors.Is(err, ErrUnsupportedFormat))
+
+	_, err = decode(bytes.NewReader([]byte("hello\n")))
+	require.True(t, errors.Is(err, ErrUnsupportedFormat))
+}
+
+func TestEncodingLegacy(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{
+		Storage: ezblob.NewMemoryStorage(),
+		Name:    "ezkv-demo",
+	}
+
+	// state written by previous versions
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	require.NoError(t, gob.NewEncoder(gw).Encode(map[string]string{"hello": "world"}))
+	require.NoError(t, gw.Close())
+
+	blob, err := ezblob.New(ezblob.Options(opts))
+	require.NoError(t, err)
+	require.NoError(t, blob.Save(ctx, buf.Bytes()))
+
+	db, err := Open(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, Record{Checksum: "world"}, db.Get("hello"))
+	require.False(t, db.Dirty())
+
+	// upgraded to current encoding on save
+	db.SetChecksum("hello", "world-2")
+	require.True(t, db.Dirty())
+	require.NoError(t, db.Save(ctx))
+
+	raw, err := blob.Load(ctx)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(raw, []byte("ezkv/2\n")))
+
+	db, err = Open(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, "world-2", db.Checksum("hello"))
+}
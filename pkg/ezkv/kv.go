@@ -1,10 +1,8 @@
 package ezkv
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/gob"
+	"io"
 	"sync"
 
 	"github.com/yankeguo/ezdeploy/pkg/ezblob"
@@ -15,7 +13,13 @@ type Options ezblob.Options
 type KV struct {
 	blob *ezblob.Blob
 	lock *sync.RWMutex
-	data map[string]string
+	data map[string]Record
+
+	// version increases on every modification, saved is the version last persisted
+	version uint64
+	saved   uint64
+	// saveLock serializes saves
+	saveLock sync.Locker
 }
 
 // Open create an instance and load existed data
@@ -27,52 +31,101 @@ func Open(ctx context.Context, opts Options) (db *KV, err error) {
 	db = &KV{
 		blob: blob,
 		lock: &sync.RWMutex{},
-		data: map[string]string{},
+		data: map[string]Record{},
+
+		saveLock: &sync.Mutex{},
 	}
-	var buf []byte
-	if buf, err = db.blob.Load(ctx); err != nil {
+	var r *ezblob.Reader
+	if r, err = db.blob.NewReader(ctx); err != nil {
 		if err == ezblob.ErrNotFound {
 			err = nil
-		} else {
-			return
 		}
-	} else {
-		if err = db.unmarshal(buf); err != nil {
-			return
+		return
+	}
+	defer r.Close()
+
+	if err = db.unmarshal(r); err != nil {
+		// current revision is corrupted, retry with the previous one
+		if cause := r.Err(); ezblob.IsCorrupted(cause) {
+			var fr *ezblob.Reader
+			if fr, err = db.blob.NewFallbackReader(ctx, cause); err != nil {
+				return
+			}
+			defer fr.Close()
+			err = db.unmarshal(fr)
 		}
+		return
 	}
 	return
 }
 
-// Put set a key-value
-func (db *KV) Put(key string, val string) {
+// Put set the record of a key
+func (db *KV) Put(key string, rec Record) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
-	db.data[key] = val
+	if old, ok := db.data[key]; ok && old.Equal(rec) {
+		return
+	}
+	db.data[key] = rec
+	db.version++
 }
 
-// Get retrieve value by key
-func (db *KV) Get(key string) string {
+// Get retrieve the record by key, zero value if not found
+func (db *KV) Get(key string) Record {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 	return db.data[key]
 }
 
-// Del delete a value by key
+// Checksum retrieve checksum of the record by key, empty if not found
+func (db *KV) Checksum(key string) string {
+	return db.Get(key).Checksum
+}
+
+// SetChecksum replace checksum of the record by key, other fields are kept
+func (db *KV) SetChecksum(key string, checksum string) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	rec := db.data[key]
+	if rec.Checksum == checksum {
+		return
+	}
+	rec.Checksum = checksum
+	db.data[key] = rec
+	db.version++
+}
+
+// Del delete a record by key
 func (db *KV) Del(key string) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
+	if _, ok := db.data[key]; !ok {
+		return
+	}
 	delete(db.data, key)
+	db.version++
+}
+
+// Range iterate all records, until fn returns false
+func (db *KV) Range(fn func(key string, rec Record) bool) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	for k, v := range db.data {
+		if !fn(k, v) {
+			return
+		}
+	}
 }
 
-// Purge iterate all entries and determine whether to delete
-func (db *KV) Purge(fn func(key string, val string) (del bool, stop bool)) {
+// Purge iterate all records and determine whether to delete
+func (db *KV) Purge(fn func(key string, rec Record) (del bool, stop bool)) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 	for k, v := range db.data {
 		del, stop := fn(k, v)
 		if del {
 			delete(db.data, k)
+			db.version++
 		}
 		if stop {
 			return
@@ -80,45 +133,75 @@ func (db *KV) Purge(fn func(key string, val string) (del bool, stop bool)) {
 	}
 }
 
-func (db *KV) unmarshal(buf []byte) (err error) {
+// unmarshal decode records from r, r is drained to the end, so that checksum of blob is verified
+func (db *KV) unmarshal(r io.Reader) (err error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	var gr *gzip.Reader
-	if gr, err = gzip.NewReader(bytes.NewReader(buf)); err != nil {
+	var data map[string]Record
+	if data, err = decode(r); err != nil {
 		return
 	}
+	db.data = data
+	return
+}
 
-	if err = gob.NewDecoder(gr).Decode(&db.data); err != nil {
-		return
+// snapshot returns a copy of records and its version
+func (db *KV) snapshot() (data map[string]Record, version uint64) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	data = make(map[string]Record, len(db.data))
+	for k, v := range db.data {
+		data[k] = v
 	}
+	version = db.version
 	return
 }
 
-func (db *KV) marshal() (data []byte, err error) {
+// Dirty returns whether there are modifications not saved yet
+func (db *KV) Dirty() bool {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
+	return db.version != db.saved
+}
+
+func (db *KV) save(ctx context.Context, force bool) (saved bool, err error) {
+	db.saveLock.Lock()
+	defer db.saveLock.Unlock()
+
+	if !force && !db.Dirty() {
+		return
+	}
+
+	data, version := db.snapshot()
 
-	buf := &bytes.Buffer{}
-	gw := gzip.NewWriter(buf)
-	if err = gob.NewEncoder(gw).Encode(&db.data); err != nil {
+	var w *ezblob.Writer
+	if w, err = db.blob.NewWriter(ctx); err != nil {
+		return
+	}
+	if err = encode(w, data); err != nil {
+		w.Abort()
 		return
 	}
-	if err = gw.Close(); err != nil {
+	if err = w.Close(); err != nil {
 		return
 	}
-	data = buf.Bytes()
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.saved = version
+	saved = true
 	return
 }
 
 // Save persist data to kubernetes
 func (db *KV) Save(ctx context.Context) (err error) {
-	var buf []byte
-	if buf, err = db.marshal(); err != nil {
-		return
-	}
-	if err = db.blob.Save(ctx, buf); err != nil {
-		return
-	}
+	_, err = db.save(ctx, true)
 	return
 }
+
+// SaveIfDirty persist data to kubernetes only if there are modifications not saved yet
+func (db *KV) SaveIfDirty(ctx context.Context) (saved bool, err error) {
+	return db.save(ctx, false)
+}
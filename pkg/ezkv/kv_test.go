@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/yankeguo/ezdeploy/pkg/ezblob"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -29,7 +30,7 @@ func TestKV(t *testing.T) {
 	require.NoError(t, err)
 
 	for i := 0; i < 1000; i++ {
-		db.Put("hello-"+strconv.Itoa(i), "world-"+strconv.Itoa(i))
+		db.Put("hello-"+strconv.Itoa(i), Record{Checksum: "world-" + strconv.Itoa(i)})
 	}
 
 	err = db.Save(ctx)
@@ -41,16 +42,16 @@ func TestKV(t *testing.T) {
 		Namespace: "default",
 	})
 	require.NoError(t, err)
-	require.Equal(t, "world-99", db.Get("hello-99"))
+	require.Equal(t, "world-99", db.Checksum("hello-99"))
 
-	db.Purge(func(key string, val string) (del bool, stop bool) {
+	db.Purge(func(key string, rec Record) (del bool, stop bool) {
 		if strings.HasSuffix(key, "9") {
 			del = true
 		}
 		return
 	})
 
-	require.Equal(t, "", db.Get("hello-99"))
+	require.Equal(t, "", db.Checksum("hello-99"))
 	err = db.Save(ctx)
 	require.NoError(t, err)
 
@@ -63,3 +64,61 @@ func TestKV(t *testing.T) {
 	err = blob.Delete(ctx)
 	require.NoError(t, err)
 }
+
+func TestKVStream(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{
+		Storage:   ezblob.NewMemoryStorage(),
+		Name:      "ezkv-demo",
+		ChunkSize: 512,
+	}
+
+	db, err := Open(ctx, opts)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		db.Put("hello-"+strconv.Itoa(i), Record{Checksum: "world-" + strconv.Itoa(i)})
+	}
+	require.NoError(t, db.Save(ctx))
+
+	db, err = Open(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, "world-99", db.Checksum("hello-99"))
+	require.False(t, db.Dirty())
+}
+
+func TestKVFallback(t *testing.T) {
+	ctx := context.Background()
+	storage := ezblob.NewMemoryStorage()
+
+	var fallbacks int
+	opts := Options{
+		Storage:    storage,
+		Name:       "ezkv-demo",
+		ChunkSize:  64,
+		OnFallback: func(revision string, previous string, err error) { fallbacks++ },
+	}
+
+	db, err := Open(ctx, opts)
+	require.NoError(t, err)
+	db.Put("hello", Record{Checksum: "world"})
+	require.NoError(t, db.Save(ctx))
+	db.Put("hello", Record{Checksum: "world-2"})
+	require.NoError(t, db.Save(ctx))
+
+	// corrupt every chunk of current revision
+	header, err := storage.Get(ctx, "ezkv-demo")
+	require.NoError(t, err)
+	chunks, err := storage.List(ctx, labels.SelectorFromSet(labels.Set{
+		ezblob.LabelKeyRevision: string(header.Data[ezblob.KeyRevision]),
+	}))
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+	for _, chunk := range chunks {
+		require.NoError(t, storage.Patch(ctx, chunk.Name, map[string][]byte{ezblob.KeyData: []byte("corrupted")}))
+	}
+
+	db, err = Open(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, "world", db.Checksum("hello"))
+	require.Equal(t, 1, fallbacks)
+}
@@ -0,0 +1,45 @@
+package ezkv
+
+import "time"
+
+const (
+	// ModeApply item applied with 'kubectl apply'
+	ModeApply = "apply"
+	// ModeRelease helm release installed or upgraded
+	ModeRelease = "release"
+	// ModeHook hook Job run to completion
+	ModeHook = "hook"
+)
+
+// Record state of an item applied to the cluster, only Checksum is known for records read from the legacy
+// encoding, or migrated from legacy checksums
+type Record struct {
+	// Checksum checksum of the applied content
+	Checksum string `json:"checksum"`
+	// Path source file the item was loaded from
+	Path string `json:"path,omitempty"`
+	// AppliedAt time the item was applied
+	AppliedAt time.Time `json:"appliedAt"`
+	// RunID id of the run applied the item
+	RunID string `json:"runId,omitempty"`
+	// Version version of ezdeploy applied the item
+	Version string `json:"version,omitempty"`
+	// GitCommit git commit of the resource root
+	GitCommit string `json:"gitCommit,omitempty"`
+	// Mode how the item was applied, one of ModeApply, ModeRelease and ModeHook
+	Mode string `json:"mode,omitempty"`
+	// Owner identity the item was applied as, empty for credentials of the run
+	Owner string `json:"owner,omitempty"`
+}
+
+// Equal returns whether two records are identical
+func (r Record) Equal(o Record) bool {
+	return r.Checksum == o.Checksum &&
+		r.Path == o.Path &&
+		r.AppliedAt.Equal(o.AppliedAt) &&
+		r.RunID == o.RunID &&
+		r.Version == o.Version &&
+		r.GitCommit == o.GitCommit &&
+		r.Mode == o.Mode &&
+		r.Owner == o.Owner
+}
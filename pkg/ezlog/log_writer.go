@@ -9,18 +9,22 @@ import (
 )
 
 type LogWriter struct {
-	logger *log.Logger
-	buf    *bytes.Buffer
-	prefix string
-	lock   sync.Locker
+	emit func(line string)
+	buf  *bytes.Buffer
+	lock sync.Locker
 }
 
 func NewLogWriter(logger *log.Logger, prefix string) io.WriteCloser {
+	return newLineWriter(func(line string) {
+		logger.Println(prefix, line)
+	})
+}
+
+func newLineWriter(emit func(line string)) *LogWriter {
 	return &LogWriter{
-		logger: logger,
-		prefix: prefix,
-		buf:    &bytes.Buffer{},
-		lock:   &sync.Mutex{},
+		emit: emit,
+		buf:  &bytes.Buffer{},
+		lock: &sync.Mutex{},
 	}
 }
 
@@ -32,12 +36,12 @@ func (w *LogWriter) finish(force bool) {
 again:
 	if line, err = w.buf.ReadString('\n'); err != nil {
 		if force {
-			w.logger.Println(w.prefix, strings.TrimSuffix(line, "\n"))
+			w.emit(strings.TrimSuffix(line, "\n"))
 		} else {
 			w.buf.WriteString(line)
 		}
 	} else {
-		w.logger.Println(w.prefix, strings.TrimSuffix(line, "\n"))
+		w.emit(strings.TrimSuffix(line, "\n"))
 		goto again
 	}
 }
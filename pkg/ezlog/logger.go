@@ -0,0 +1,63 @@
+package ezlog
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const (
+	KeyNamespace = "namespace"
+	KeyRelease   = "release"
+	KeyResource  = "resource"
+	KeyHook      = "hook"
+	KeyPhase     = "phase"
+	KeyDuration  = "duration"
+	KeyStream    = "stream"
+	KeyCommand   = "command"
+	KeyLine      = "line"
+	KeyError     = "error"
+	KeyRunID     = "run_id"
+	KeyVersion   = "version"
+	KeyCommit    = "git_commit"
+)
+
+// ParseLevel parse a level name, one of debug, info, warn and error
+func ParseLevel(s string) (level slog.Level, err error) {
+	if err = level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		err = errors.New("invalid log level: '" + s + "'")
+		return
+	}
+	return
+}
+
+// New create a structured logger writing to w, with format text or json
+func New(w io.Writer, format string, level string) (logger *slog.Logger, err error) {
+	var lvl slog.Level
+	if lvl, err = ParseLevel(level); err != nil {
+		return
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case FormatText, "":
+		logger = slog.New(slog.NewTextHandler(w, opts))
+	case FormatJSON:
+		logger = slog.New(slog.NewJSONHandler(w, opts))
+	default:
+		err = errors.New("invalid log format: '" + format + "'")
+	}
+	return
+}
+
+// NewEventWriter create a writer emitting every line as an event with message msg
+func NewEventWriter(logger *slog.Logger, msg string, args ...any) io.WriteCloser {
+	return newLineWriter(func(line string) {
+		logger.Info(msg, append(append([]any{}, args...), KeyLine, line)...)
+	})
+}
@@ -0,0 +1,71 @@
+package ezlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(out, FormatJSON, "warn")
+	require.NoError(t, err)
+	logger.Info("hidden")
+	logger.Warn("shown", KeyNamespace, "default")
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &m))
+	require.Equal(t, "shown", m["msg"])
+	require.Equal(t, "default", m[KeyNamespace])
+
+	_, err = New(out, "xml", "info")
+	require.Error(t, err)
+	_, err = New(out, FormatText, "verbose")
+	require.Error(t, err)
+}
+
+func TestEventWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(out, FormatJSON, "info")
+	require.NoError(t, err)
+	w := NewEventWriter(logger, "output", KeyCommand, "kubectl", KeyStream, "stdout")
+	_, err = w.Write([]byte("hello\nwor"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dec := json.NewDecoder(out)
+	var lines []string
+	for dec.More() {
+		var m map[string]any
+		require.NoError(t, dec.Decode(&m))
+		require.Equal(t, "kubectl", m[KeyCommand])
+		lines = append(lines, m[KeyLine].(string))
+	}
+	require.Equal(t, []string{"hello", "wor"}, lines)
+}
+
+func TestRedactHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(out, FormatJSON, "info")
+	require.NoError(t, err)
+
+	redact := func(s string) string {
+		return strings.ReplaceAll(s, "s3cr3t", "******")
+	}
+	logger = slog.New(NewRedactHandler(logger.Handler(), redact)).With(KeyCommand, "s3cr3t")
+	logger.Info("password is s3cr3t", KeyLine, "token: s3cr3t", KeyError, errors.New("bad s3cr3t"))
+
+	require.NotContains(t, out.String(), "s3cr3t")
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &m))
+	require.Equal(t, "password is ******", m["msg"])
+	require.Equal(t, "token: ******", m[KeyLine])
+	require.Equal(t, "bad ******", m[KeyError])
+	require.Equal(t, "******", m[KeyCommand])
+}
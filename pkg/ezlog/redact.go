@@ -0,0 +1,61 @@
+package ezlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+type redactHandler struct {
+	next   slog.Handler
+	redact func(s string) string
+}
+
+// NewRedactHandler wrap a handler, message and all string and error attributes are passed through redact
+func NewRedactHandler(next slog.Handler, redact func(s string) string) slog.Handler {
+	return &redactHandler{next: next, redact: redact}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redact(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		out := make([]any, 0, len(attrs))
+		for _, attr := range attrs {
+			out = append(out, h.redactAttr(attr))
+		}
+		return slog.Group(a.Key, out...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, h.redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, h.redactAttr(a))
+	}
+	return &redactHandler{next: h.next.WithAttrs(out), redact: h.redact}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), redact: h.redact}
+}
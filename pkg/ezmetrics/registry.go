@@ -0,0 +1,267 @@
+package ezmetrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+)
+
+// Labels label names and values of a series
+type Labels map[string]string
+
+func (l Labels) key() string {
+	names := make([]string, 0, len(l))
+	for k := range l {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	sb := &strings.Builder{}
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteRune(',')
+		}
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(l[k]))
+		sb.WriteRune('"')
+	}
+	return sb.String()
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type series struct {
+	labels string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	buckets []float64
+	series  map[string]*series
+}
+
+// Registry a set of metric families, safe for concurrent use
+type Registry struct {
+	families map[string]*family
+	lock     sync.Locker
+}
+
+// NewRegistry create a Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		families: map[string]*family{},
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (r *Registry) series(name string, help string, typ string, buckets []float64, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			name:    name,
+			help:    help,
+			typ:     typ,
+			buckets: buckets,
+			series:  map[string]*series{},
+		}
+		r.families[name] = f
+	}
+	if f.typ != typ {
+		panic(errors.New("ezmetrics: metric '" + name + "' registered as " + f.typ + ", used as " + typ))
+	}
+	key := labels.key()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+// AddCounter add v to a counter
+func (r *Registry) AddCounter(name string, help string, labels Labels, v float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.series(name, help, TypeCounter, nil, labels).value += v
+}
+
+// SetGauge set a gauge to v
+func (r *Registry) SetGauge(name string, help string, labels Labels, v float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.series(name, help, TypeGauge, nil, labels).value = v
+}
+
+// ObserveHistogram observe v in a histogram, buckets are fixed by the first observation
+func (r *Registry) ObserveHistogram(name string, help string, buckets []float64, labels Labels, v float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.series(name, help, TypeHistogram, buckets, labels)
+	for i, le := range r.families[name].buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func writeSample(w io.Writer, name string, labels string, extra string, v string) (err error) {
+	if extra != "" {
+		if labels != "" {
+			labels = labels + "," + extra
+		} else {
+			labels = extra
+		}
+	}
+	if labels != "" {
+		_, err = fmt.Fprintf(w, "%s{%s} %s\n", name, labels, v)
+	} else {
+		_, err = fmt.Fprintf(w, "%s %s\n", name, v)
+	}
+	return
+}
+
+// WriteText write all metrics in Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		if _, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ); err != nil {
+			return
+		}
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ != TypeHistogram {
+				if err = writeSample(w, f.name, s.labels, "", formatFloat(s.value)); err != nil {
+					return
+				}
+				continue
+			}
+			for i, le := range f.buckets {
+				if err = writeSample(w, f.name+"_bucket", s.labels, `le="`+formatFloat(le)+`"`, strconv.FormatUint(s.counts[i], 10)); err != nil {
+					return
+				}
+			}
+			if err = writeSample(w, f.name+"_bucket", s.labels, `le="+Inf"`, strconv.FormatUint(s.count, 10)); err != nil {
+				return
+			}
+			if err = writeSample(w, f.name+"_sum", s.labels, "", formatFloat(s.sum)); err != nil {
+				return
+			}
+			if err = writeSample(w, f.name+"_count", s.labels, "", strconv.FormatUint(s.count, 10)); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// WriteTextfile atomically write all metrics to a file, for node-exporter textfile collector
+func (r *Registry) WriteTextfile(file string) (err error) {
+	var f *os.File
+	if f, err = os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*"); err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = r.WriteText(f); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// Push replace metrics of job in a Pushgateway compatible endpoint
+func (r *Registry) Push(ctx context.Context, endpoint string, job string) (err error) {
+	buf := &bytes.Buffer{}
+	if err = r.WriteText(buf); err != nil {
+		return
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		strings.TrimSuffix(endpoint, "/")+"/metrics/job/"+url.PathEscape(job),
+		buf,
+	); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	var res *http.Response
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		err = errors.New("ezmetrics: push failed with status " + res.Status + ": " + strings.TrimSpace(string(body)))
+		return
+	}
+	return
+}
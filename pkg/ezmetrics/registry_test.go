@@ -0,0 +1,74 @@
+package ezmetrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.AddCounter("demo_total", "demo counter", Labels{"namespace": "b"}, 1)
+	r.AddCounter("demo_total", "demo counter", Labels{"namespace": "a"}, 2)
+	r.AddCounter("demo_total", "demo counter", Labels{"namespace": "a"}, 1)
+	r.SetGauge("demo_gauge", "demo gauge", nil, 1.5)
+	r.ObserveHistogram("demo_seconds", "demo histogram", []float64{1, 5}, Labels{"command": `k"c`}, 3)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.WriteText(buf))
+	require.Equal(t, `# HELP demo_gauge demo gauge
+# TYPE demo_gauge gauge
+demo_gauge 1.5
+# HELP demo_seconds demo histogram
+# TYPE demo_seconds histogram
+demo_seconds_bucket{command="k\"c",le="1"} 0
+demo_seconds_bucket{command="k\"c",le="5"} 1
+demo_seconds_bucket{command="k\"c",le="+Inf"} 1
+demo_seconds_sum{command="k\"c"} 3
+demo_seconds_count{command="k\"c"} 1
+# HELP demo_total demo counter
+# TYPE demo_total counter
+demo_total{namespace="a"} 3
+demo_total{namespace="b"} 1
+`, buf.String())
+
+	require.Panics(t, func() {
+		r.SetGauge("demo_total", "demo", nil, 1)
+	})
+}
+
+func TestRegistryWriteTextfile(t *testing.T) {
+	r := NewRegistry()
+	r.SetGauge("demo", "demo", nil, 1)
+	file := filepath.Join(t.TempDir(), "ezdeploy.prom")
+	require.NoError(t, r.WriteTextfile(file))
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "# HELP demo demo\n# TYPE demo gauge\ndemo 1\n", string(buf))
+}
+
+func TestRegistryPush(t *testing.T) {
+	var (
+		path string
+		body []byte
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		body, _ = io.ReadAll(req.Body)
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	r := NewRegistry()
+	r.SetGauge("demo", "demo", nil, 1)
+	require.NoError(t, r.Push(context.Background(), s.URL+"/", "ezdeploy"))
+	require.Equal(t, "/metrics/job/ezdeploy", path)
+	require.Contains(t, string(body), "demo 1")
+}
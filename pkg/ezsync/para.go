@@ -2,21 +2,124 @@ package ezsync
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 )
 
+var (
+	ErrSkipped = errors.New("skipped")
+)
+
+// ItemError an error belonging to a named item
+type ItemError struct {
+	Item string
+	Err  error
+}
+
+func (e ItemError) Error() string {
+	return e.Item + ": " + e.Err.Error()
+}
+
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// ItemErrors errors of items, in order of items
+type ItemErrors []ItemError
+
+func (errs ItemErrors) Error() string {
+	sb := &strings.Builder{}
+	for _, err := range errs {
+		if sb.Len() > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+func (errs ItemErrors) Unwrap() []error {
+	out := make([]error, 0, len(errs))
+	for _, err := range errs {
+		out = append(out, err)
+	}
+	return out
+}
+
+// Get returns error of the named item, or nil
+func (errs ItemErrors) Get(item string) error {
+	for _, err := range errs {
+		if err.Item == item {
+			return err.Err
+		}
+	}
+	return nil
+}
+
+// DoPara run fn for every item with limited concurrency, and wait for all of them, errors are keyed by fmt.Sprint of items
 func DoPara[T any](ctx context.Context, vs []T, concurrency int, fn func(ctx context.Context, v T) (err error)) (err error) {
+	return DoParaCtx(ctx, vs, concurrency, false, func(v T) string {
+		return fmt.Sprint(v)
+	}, fn)
+}
+
+// DoParaCtx run fn for every item with limited concurrency, errors are keyed by name of items.
+// Items not started yet when ctx is cancelled are skipped with ErrSkipped, wrapping the cause.
+// With failFast, the context passed to fn is cancelled on the first error
+func DoParaCtx[T any](ctx context.Context, vs []T, concurrency int, failFast bool, name func(v T) string, fn func(ctx context.Context, v T) (err error)) (err error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	type indexedError struct {
+		index int
+		err   ItemError
+	}
+
+	var (
+		errs []indexedError
+		lock = &sync.Mutex{}
+	)
+
 	pg := NewParaGroup(concurrency)
-	eg := NewErrorGroup()
-	for _, _v := range vs {
-		v := _v
+	for _i, _v := range vs {
+		i, v := _i, _v
 		pg.Mark()
 		go func() {
 			pg.Take()
 			defer pg.Done()
-			eg.Add(fn(ctx, v))
+
+			var err error
+			if ctx.Err() != nil {
+				err = fmt.Errorf("%w, %w", ErrSkipped, context.Cause(ctx))
+			} else if err = fn(ctx, v); err != nil && failFast {
+				cancel(ItemError{Item: name(v), Err: err})
+			}
+			if err == nil {
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, indexedError{index: i, err: ItemError{Item: name(v), Err: err}})
 		}()
 	}
 	pg.Wait()
-	err = eg.Unwrap()
+
+	if len(errs) == 0 {
+		return
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].index < errs[j].index
+	})
+
+	out := make(ItemErrors, 0, len(errs))
+	for _, e := range errs {
+		out = append(out, e.err)
+	}
+	err = out
 	return
 }
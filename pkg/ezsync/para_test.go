@@ -2,8 +2,10 @@ package ezsync
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/require"
 	"sort"
+	"sync/atomic"
 	"testing"
 )
 
@@ -22,3 +24,67 @@ func TestParaDo(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, vs, out)
 }
+
+func TestParaDoErrors(t *testing.T) {
+	err := DoPara(context.Background(), []string{"a", "b", "c"}, 3, func(ctx context.Context, v string) (err error) {
+		if v != "b" {
+			err = errors.New("failed " + v)
+		}
+		return
+	})
+	require.Equal(t, "a: failed a; c: failed c", err.Error())
+
+	var errs ItemErrors
+	require.True(t, errors.As(err, &errs))
+	require.Error(t, errs.Get("c"))
+	require.NoError(t, errs.Get("b"))
+}
+
+func TestDoParaCtxFailFast(t *testing.T) {
+	var (
+		started int32
+		failed  atomic.Value
+	)
+	boom := errors.New("boom")
+
+	name := func(v int) string {
+		return string(rune('a' + v - 1))
+	}
+
+	err := DoParaCtx(context.Background(), []int{1, 2, 3, 4, 5}, 2, true, name, func(ctx context.Context, v int) (err error) {
+		// the first item started fails, whichever it is
+		if atomic.AddInt32(&started, 1) == 1 {
+			failed.Store(name(v))
+			return boom
+		}
+		// in-flight items observe cancellation
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.Error(t, err)
+	require.True(t, errors.Is(err, boom))
+	require.True(t, errors.Is(err, ErrSkipped))
+	require.LessOrEqual(t, atomic.LoadInt32(&started), int32(2))
+
+	var errs ItemErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 5)
+	require.Equal(t, "a", errs[0].Item)
+	require.Equal(t, boom, errs.Get(failed.Load().(string)))
+}
+
+func TestDoParaCtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := DoParaCtx(ctx, []string{"a", "b"}, 1, false, func(v string) string {
+		return v
+	}, func(ctx context.Context, v string) (err error) {
+		t.Fatal("should not start")
+		return
+	})
+	require.True(t, errors.Is(err, ErrSkipped))
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, "a: skipped, context canceled; b: skipped, context canceled", err.Error())
+}
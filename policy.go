@@ -0,0 +1,282 @@
+package ezdeploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	PolicyNoLatestTag    = "no-latest-tag"
+	PolicyResources      = "resources"
+	PolicyNoPrivileged   = "no-privileged"
+	PolicyNoHostPath     = "no-host-path"
+	PolicyRequiredLabels = "required-labels"
+
+	SeverityOff  = "off"
+	SeverityWarn = "warn"
+	SeverityDeny = "deny"
+
+	// AnnotationPolicyExempt comma separated rules a resource is exempted from, '*' for all rules
+	AnnotationPolicyExempt = "ezdeploy.yankeguo.github.io/policy-exempt"
+)
+
+var (
+	ErrPolicyDenied = errors.New("denied by policy")
+
+	policyRules = []string{PolicyNoLatestTag, PolicyResources, PolicyNoPrivileged, PolicyNoHostPath, PolicyRequiredLabels}
+)
+
+// Policy severity of each rule, rules not mentioned are off
+type Policy struct {
+	// Rules severity by rule name, one of off, warn and deny
+	Rules map[string]string `yaml:"rules"`
+	// RequiredLabels labels every resource must have, checked by rule 'required-labels'
+	RequiredLabels []string `yaml:"requiredLabels"`
+}
+
+// Validate check rule names and severities
+func (p Policy) Validate() error {
+	for rule, severity := range p.Rules {
+		known := false
+		for _, item := range policyRules {
+			if item == rule {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.New("unknown rule '" + rule + "'")
+		}
+		switch severity {
+		case SeverityOff, SeverityWarn, SeverityDeny:
+		default:
+			return errors.New("invalid severity of rule '" + rule + "': '" + severity + "'")
+		}
+	}
+	return nil
+}
+
+// Enabled returns whether any rule is enabled
+func (p Policy) Enabled() bool {
+	for _, severity := range p.Rules {
+		if severity == SeverityWarn || severity == SeverityDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyConfig default policy, with overrides per namespace
+type PolicyConfig struct {
+	Policy `yaml:",inline"`
+	// Namespaces overrides by namespace, rules are merged, required labels are replaced if not empty
+	Namespaces map[string]Policy `yaml:"namespaces"`
+}
+
+// Validate check default policy and all overrides
+func (c PolicyConfig) Validate() error {
+	if err := c.Policy.Validate(); err != nil {
+		return err
+	}
+	for ns, p := range c.Namespaces {
+		if err := p.Validate(); err != nil {
+			return errors.New("namespace '" + ns + "': " + err.Error())
+		}
+	}
+	return nil
+}
+
+// ForNamespace returns the effective policy of a namespace
+func (c PolicyConfig) ForNamespace(namespace string) Policy {
+	p := Policy{
+		Rules:          map[string]string{},
+		RequiredLabels: c.RequiredLabels,
+	}
+	for rule, severity := range c.Rules {
+		p.Rules[rule] = severity
+	}
+	if o, ok := c.Namespaces[namespace]; ok {
+		for rule, severity := range o.Rules {
+			p.Rules[rule] = severity
+		}
+		if len(o.RequiredLabels) > 0 {
+			p.RequiredLabels = o.RequiredLabels
+		}
+	}
+	return p
+}
+
+// PolicyViolation a resource violating a rule
+type PolicyViolation struct {
+	Rule     string
+	Severity string
+	ID       string
+	Path     string
+	Message  string
+}
+
+func (v PolicyViolation) String() string {
+	return v.ID + ": " + v.Rule + ": " + v.Message
+}
+
+type policyObject struct {
+	Metadata struct {
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+}
+
+// podSpecOf extract pod spec of Pod, workloads and CronJob, nil for other kinds
+func podSpecOf(res Resource) (spec *corev1.PodSpec, err error) {
+	switch res.Object.Kind {
+	case "Pod":
+		var obj struct {
+			Spec corev1.PodSpec `json:"spec"`
+		}
+		if err = json.Unmarshal(res.Raw, &obj); err != nil {
+			return
+		}
+		spec = &obj.Spec
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		var obj struct {
+			Spec struct {
+				Template corev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		if err = json.Unmarshal(res.Raw, &obj); err != nil {
+			return
+		}
+		spec = &obj.Spec.Template.Spec
+	case "CronJob":
+		var obj struct {
+			Spec struct {
+				JobTemplate struct {
+					Spec struct {
+						Template corev1.PodTemplateSpec `json:"template"`
+					} `json:"spec"`
+				} `json:"jobTemplate"`
+			} `json:"spec"`
+		}
+		if err = json.Unmarshal(res.Raw, &obj); err != nil {
+			return
+		}
+		spec = &obj.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return
+}
+
+// isLatestImage returns whether image is untagged or tagged 'latest', images pinned by digest are not
+func isLatestImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	idx := strings.LastIndex(name, ":")
+	return idx < 0 || name[idx+1:] == "latest"
+}
+
+// Check check a resource against all enabled rules, rules exempted by annotation are skipped
+func (p Policy) Check(res Resource) (violations []PolicyViolation, err error) {
+	if !p.Enabled() {
+		return
+	}
+
+	var obj policyObject
+	if err = json.Unmarshal(res.Raw, &obj); err != nil {
+		return
+	}
+
+	exempted := map[string]bool{}
+	for _, item := range strings.Split(obj.Metadata.Annotations[AnnotationPolicyExempt], ",") {
+		exempted[strings.TrimSpace(item)] = true
+	}
+
+	add := func(rule string, msg string) {
+		severity := p.Rules[rule]
+		if severity == "" || severity == SeverityOff || exempted[rule] || exempted["*"] {
+			return
+		}
+		violations = append(violations, PolicyViolation{
+			Rule:     rule,
+			Severity: severity,
+			ID:       res.ID,
+			Path:     res.Path,
+			Message:  msg,
+		})
+	}
+
+	for _, label := range p.RequiredLabels {
+		if _, ok := obj.Metadata.Labels[label]; !ok {
+			add(PolicyRequiredLabels, "missing label '"+label+"'")
+		}
+	}
+
+	var spec *corev1.PodSpec
+	if spec, err = podSpecOf(res); err != nil || spec == nil {
+		return
+	}
+
+	for _, vol := range spec.Volumes {
+		if vol.HostPath != nil {
+			add(PolicyNoHostPath, "volume '"+vol.Name+"' uses hostPath '"+vol.HostPath.Path+"'")
+		}
+	}
+
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			if isLatestImage(c.Image) {
+				add(PolicyNoLatestTag, "container '"+c.Name+"' uses image '"+c.Image+"' without a pinned tag")
+			}
+			if c.SecurityContext != nil && c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged {
+				add(PolicyNoPrivileged, "container '"+c.Name+"' is privileged")
+			}
+			var missing []string
+			for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				if _, ok := c.Resources.Requests[name]; !ok {
+					missing = append(missing, "requests."+string(name))
+				}
+				if _, ok := c.Resources.Limits[name]; !ok {
+					missing = append(missing, "limits."+string(name))
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				add(PolicyResources, "container '"+c.Name+"' is missing "+strings.Join(missing, ", "))
+			}
+		}
+	}
+	return
+}
+
+// CheckAll check all resources, returns all violations, and an error wrapping ErrPolicyDenied if any of
+// them is denied
+func (p Policy) CheckAll(resources []Resource) (violations []PolicyViolation, err error) {
+	if !p.Enabled() {
+		return
+	}
+
+	var denied []string
+	for _, res := range resources {
+		var items []PolicyViolation
+		if items, err = p.Check(res); err != nil {
+			err = errors.New("failed to check policy of " + res.ID + ": " + err.Error())
+			return
+		}
+		for _, item := range items {
+			if item.Severity == SeverityDeny {
+				denied = append(denied, item.String())
+			}
+		}
+		violations = append(violations, items...)
+	}
+
+	if len(denied) > 0 {
+		err = fmt.Errorf("%w: %s", ErrPolicyDenied, strings.Join(denied, "; "))
+	}
+	return
+}
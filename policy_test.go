@@ -0,0 +1,129 @@
+package ezdeploy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPolicyConfig(t *testing.T) {
+	var cfg PolicyConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+rules:
+  no-latest-tag: deny
+  resources: warn
+requiredLabels: [app]
+namespaces:
+  kube-system:
+    rules:
+      no-latest-tag: "off"
+    requiredLabels: [team]
+`), &cfg))
+	require.NoError(t, cfg.Validate())
+
+	p := cfg.ForNamespace("default")
+	require.Equal(t, SeverityDeny, p.Rules[PolicyNoLatestTag])
+	require.Equal(t, []string{"app"}, p.RequiredLabels)
+	require.True(t, p.Enabled())
+
+	p = cfg.ForNamespace("kube-system")
+	require.Equal(t, SeverityOff, p.Rules[PolicyNoLatestTag])
+	require.Equal(t, SeverityWarn, p.Rules[PolicyResources])
+	require.Equal(t, []string{"team"}, p.RequiredLabels)
+
+	require.False(t, PolicyConfig{}.ForNamespace("default").Enabled())
+
+	require.Error(t, Policy{Rules: map[string]string{"no-root": SeverityDeny}}.Validate())
+	require.Error(t, Policy{Rules: map[string]string{PolicyResources: "error"}}.Validate())
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := Policy{
+		Rules: map[string]string{
+			PolicyNoLatestTag:    SeverityDeny,
+			PolicyResources:      SeverityWarn,
+			PolicyNoPrivileged:   SeverityDeny,
+			PolicyNoHostPath:     SeverityDeny,
+			PolicyRequiredLabels: SeverityWarn,
+		},
+		RequiredLabels: []string{"app"},
+	}
+
+	resources, err := ParseManifests("default", "rendered.yaml", []byte(`
+---
+# Source: demo/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: bad
+spec:
+  template:
+    spec:
+      volumes:
+        - name: host
+          hostPath:
+            path: /var/run
+      containers:
+        - name: main
+          image: nginx
+          securityContext:
+            privileged: true
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: good
+  labels:
+    app: good
+spec:
+  template:
+    spec:
+      containers:
+        - name: main
+          image: registry.example.com:5000/nginx:1.25
+          resources:
+            requests: {cpu: 100m, memory: 64Mi}
+            limits: {cpu: 200m, memory: 128Mi}
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: exempted
+  labels:
+    app: cron
+  annotations:
+    ezdeploy.yankeguo.github.io/policy-exempt: no-latest-tag, resources
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: main
+              image: busybox:latest
+`))
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+	require.Equal(t, "default::apps/v1/Deployment/bad", resources[0].ID)
+
+	violations, err := p.CheckAll(resources)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrPolicyDenied))
+
+	var rules []string
+	for _, v := range violations {
+		require.Equal(t, "default::apps/v1/Deployment/bad", v.ID)
+		rules = append(rules, v.Rule)
+	}
+	require.Equal(t, []string{PolicyRequiredLabels, PolicyNoHostPath, PolicyNoLatestTag, PolicyNoPrivileged, PolicyResources}, rules)
+
+	violations, err = p.CheckAll(resources[1:])
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	require.True(t, isLatestImage("nginx"))
+	require.True(t, isLatestImage("localhost:5000/nginx"))
+	require.False(t, isLatestImage("nginx@sha256:abcd"))
+}
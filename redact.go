@@ -0,0 +1,190 @@
+package ezdeploy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RedactedValue = "******"
+
+	// minRedactLength values shorter than this are not redacted, to avoid masking unrelated text
+	minRedactLength = 8
+)
+
+var (
+	// DefaultRedactKeys patterns of sensitive keys, whose values are always redacted
+	DefaultRedactKeys = []string{`(?i)(password|passwd|token|api[-_]?key|private[-_]?key|client[-_]?secret)`}
+
+	redactLinePattern = regexp.MustCompile(`^(\s*-?\s*["']?([\w.-]+)["']?\s*[:=]\s*)(\S.*)$`)
+
+	// redactIdentifierPattern plain lowercase words and numbers, like names of namespaces and resources, they are
+	// not redacted since masking them everywhere hides unrelated text
+	redactIdentifierPattern = regexp.MustCompile(`^([a-z]+|[0-9]+)$`)
+)
+
+// Redactor masks known sensitive values, collected from Secrets and sensitive keys of resources and Helm
+// values, in any text. A nil Redactor redacts nothing
+type Redactor struct {
+	keys     []*regexp.Regexp
+	values   map[string]struct{}
+	replacer *strings.Replacer
+	lock     sync.Locker
+}
+
+// NewRedactor create a Redactor with DefaultRedactKeys and additional key patterns
+func NewRedactor(keys []string) (r *Redactor, err error) {
+	r = &Redactor{
+		values: map[string]struct{}{},
+		lock:   &sync.Mutex{},
+	}
+	for _, key := range append(append([]string{}, DefaultRedactKeys...), keys...) {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(key); err != nil {
+			err = errors.New("invalid redact key pattern '" + key + "': " + err.Error())
+			return
+		}
+		r.keys = append(r.keys, re)
+	}
+	return
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	for _, re := range r.keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddValue register a sensitive value
+func (r *Redactor) AddValue(v string) {
+	if r == nil {
+		return
+	}
+	v = strings.TrimSpace(v)
+	if len(v) < minRedactLength || redactIdentifierPattern.MatchString(v) {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.values[v]; ok {
+		return
+	}
+	r.values[v] = struct{}{}
+	r.replacer = nil
+}
+
+// addSensitive register string leaves of v, all of them if sensitive, or those under sensitive keys
+func (r *Redactor) addSensitive(v any, sensitive bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			r.addSensitive(item, sensitive || r.sensitiveKey(k))
+		}
+	case []any:
+		for _, item := range v {
+			r.addSensitive(item, sensitive)
+		}
+	case string:
+		if !sensitive {
+			return
+		}
+		r.AddValue(v)
+		for _, line := range strings.Split(v, "\n") {
+			r.AddValue(line)
+		}
+	}
+}
+
+// AddObject register sensitive values of a resource, all values of a Secret, and values under sensitive keys
+// of other resources
+func (r *Redactor) AddObject(raw json.RawMessage) {
+	if r == nil {
+		return
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return
+	}
+	if obj["kind"] == "Secret" && obj["apiVersion"] == "v1" {
+		if data, ok := obj["data"].(map[string]any); ok {
+			for _, item := range data {
+				s, ok := item.(string)
+				if !ok {
+					continue
+				}
+				r.AddValue(s)
+				if buf, err := base64.StdEncoding.DecodeString(s); err == nil {
+					r.addSensitive(string(buf), true)
+				}
+			}
+		}
+		r.addSensitive(obj["stringData"], true)
+		return
+	}
+	r.addSensitive(obj, false)
+}
+
+// AddValuesFile register values under sensitive keys of a Helm values file in YAML
+func (r *Redactor) AddValuesFile(file string) (err error) {
+	if r == nil {
+		return
+	}
+	var buf []byte
+	if buf, err = os.ReadFile(file); err != nil {
+		return
+	}
+	var values map[string]any
+	if err = yaml.Unmarshal(buf, &values); err != nil {
+		return
+	}
+	r.addSensitive(values, false)
+	return
+}
+
+func (r *Redactor) getReplacer() *strings.Replacer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.replacer == nil {
+		values := make([]string, 0, len(r.values))
+		for v := range r.values {
+			values = append(values, v)
+		}
+		// longer values first, in case of one containing another
+		sort.Slice(values, func(i, j int) bool {
+			return len(values[i]) > len(values[j])
+		})
+		args := make([]string, 0, len(values)*2)
+		for _, v := range values {
+			args = append(args, v, RedactedValue)
+		}
+		r.replacer = strings.NewReplacer(args...)
+	}
+	return r.replacer
+}
+
+// Redact mask all registered values, and values of lines like 'key: value' with a sensitive key
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	s = r.getReplacer().Replace(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if m := redactLinePattern.FindStringSubmatch(line); m != nil && r.sensitiveKey(m[2]) {
+			lines[i] = m[1] + RedactedValue
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,36 @@
+package ezdeploy
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor([]string{`(?i)dsn$`})
+	require.NoError(t, err)
+
+	r.AddObject([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds"},"data":{"key":"` +
+		base64.StdEncoding.EncodeToString([]byte("decoded-secret")) + `"},"stringData":{"plain":"plain-secret"}}`))
+	r.AddObject([]byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cfg"},"data":{"db.password":"cm-password","name":"visible"}}`))
+
+	file := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("db:\n  user: admin\n  dsn: mysql://x@y\nauth:\n  apiKey: abcdefg1\n"), 0640))
+	require.NoError(t, r.AddValuesFile(file))
+
+	out := r.Redact("decoded-secret plain-secret cm-password visible mysql://x@y abcdefg1 admin creds")
+	require.Equal(t, "****** ****** ****** visible ****** ****** admin creds", out)
+
+	require.Equal(t, "  password: ******\n  user: admin", r.Redact("  password: unknown\n  user: admin"))
+	require.Equal(t, "hello", (*Redactor)(nil).Redact("hello"))
+
+	// short values and plain identifiers do not mask names elsewhere
+	r.AddObject([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"common"},"stringData":{"user":"admin","namespace":"default","db":"production","port":"15432"}}`))
+	require.Equal(t, "namespace default, user admin, deployment production, port 15432", r.Redact("namespace default, user admin, deployment production, port 15432"))
+
+	_, err = NewRedactor([]string{"("})
+	require.Error(t, err)
+}
@@ -0,0 +1,270 @@
+package ezdeploy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outcome outcome of a resource, release or hook in a run
+type Outcome string
+
+const (
+	OutcomeSkipped Outcome = "skipped-unchanged"
+	OutcomeApplied Outcome = "applied"
+	OutcomeFailed  Outcome = "failed"
+)
+
+const (
+	ReportKindResource = "resource"
+	ReportKindRelease  = "release"
+	ReportKindHook     = "hook"
+)
+
+// ReportItem outcome of a single resource, release or hook
+type ReportItem struct {
+	ID             string  `json:"id"`
+	Kind           string  `json:"kind"`
+	Object         *Object `json:"object,omitempty"`
+	Path           string  `json:"path,omitempty"`
+	Outcome        Outcome `json:"outcome"`
+	ChecksumBefore string  `json:"checksumBefore,omitempty"`
+	ChecksumAfter  string  `json:"checksumAfter,omitempty"`
+	Duration       float64 `json:"durationSeconds"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// NamespaceReport outcomes of a namespace
+type NamespaceReport struct {
+	Namespace string       `json:"namespace"`
+	Items     []ReportItem `json:"items"`
+	Duration  float64      `json:"durationSeconds"`
+	Error     string       `json:"error,omitempty"`
+
+	lock sync.Locker
+}
+
+// Add record an item, nil-safe
+func (nr *NamespaceReport) Add(item ReportItem) {
+	if nr == nil {
+		return
+	}
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+	nr.Items = append(nr.Items, item)
+}
+
+// Counts returns number of items by outcome
+func (nr *NamespaceReport) Counts() map[Outcome]int {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+	counts := map[Outcome]int{}
+	for _, item := range nr.Items {
+		counts[item.Outcome]++
+	}
+	return counts
+}
+
+// Finish record duration and error of the namespace, nil-safe
+func (nr *NamespaceReport) Finish(duration time.Duration, err error) {
+	if nr == nil {
+		return
+	}
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+	nr.Duration = duration.Seconds()
+	if err != nil {
+		nr.Error = err.Error()
+	}
+}
+
+// Report outcomes of a whole run
+type Report struct {
+	RunID      string             `json:"runId"`
+	Version    string             `json:"version"`
+	GitCommit  string             `json:"gitCommit,omitempty"`
+	StartedAt  time.Time          `json:"startedAt"`
+	FinishedAt time.Time          `json:"finishedAt"`
+	DryRun     bool               `json:"dryRun"`
+	Namespaces []*NamespaceReport `json:"namespaces"`
+	Error      string             `json:"error,omitempty"`
+
+	lock sync.Locker
+}
+
+// NewRunID create a unique run id, prefixed with current time
+func NewRunID() string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// NewReport create a Report started now, with a new run id and current version
+func NewReport(dryRun bool) *Report {
+	return &Report{
+		RunID:     NewRunID(),
+		Version:   BuildVersion(),
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		lock:      &sync.Mutex{},
+	}
+}
+
+// Namespace get or create the report of a namespace, nil-safe
+func (r *Report) Namespace(namespace string) *NamespaceReport {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, nr := range r.Namespaces {
+		if nr.Namespace == namespace {
+			return nr
+		}
+	}
+	nr := &NamespaceReport{
+		Namespace: namespace,
+		Items:     []ReportItem{},
+		lock:      r.lock,
+	}
+	r.Namespaces = append(r.Namespaces, nr)
+	return nr
+}
+
+// Finish record finish time and error of the run, namespaces are sorted by name
+func (r *Report) Finish(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.FinishedAt = time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	sort.Slice(r.Namespaces, func(i, j int) bool {
+		return r.Namespaces[i].Namespace < r.Namespaces[j].Namespace
+	})
+}
+
+// Redact pass all error messages through fn
+func (r *Report) Redact(fn func(s string) string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Error = fn(r.Error)
+	for _, nr := range r.Namespaces {
+		nr.Error = fn(nr.Error)
+		for i := range nr.Items {
+			nr.Items[i].Error = fn(nr.Items[i].Error)
+		}
+	}
+}
+
+// WriteJSON write report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr"`
+	Time       string           `xml:"time,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+func formatJUnitTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// WriteJUnit write report as JUnit XML, one test suite per namespace and one test case per item
+func (r *Report) WriteJUnit(w io.Writer) (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := junitTestSuites{
+		Name: "ezdeploy",
+		Time: formatJUnitTime(r.FinishedAt.Sub(r.StartedAt).Seconds()),
+	}
+
+	for _, nr := range r.Namespaces {
+		suite := junitTestSuite{
+			Name: nr.Namespace,
+			Time: formatJUnitTime(nr.Duration),
+		}
+		for _, item := range nr.Items {
+			tc := junitTestCase{
+				Name:      item.ID,
+				ClassName: nr.Namespace + "." + item.Kind,
+				Time:      formatJUnitTime(item.Duration),
+				File:      item.Path,
+			}
+			switch item.Outcome {
+			case OutcomeFailed:
+				tc.Failure = &junitFailure{Message: string(item.Outcome), Text: item.Error}
+				suite.Failures++
+			case OutcomeSkipped:
+				tc.Skipped = &junitSkipped{Message: string(item.Outcome)}
+				suite.Skipped++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		// namespace level error not attached to any item, e.g. failed to load
+		if nr.Error != "" && suite.Failures == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      nr.Namespace,
+				ClassName: nr.Namespace + ".namespace",
+				Time:      formatJUnitTime(nr.Duration),
+				Failure:   &junitFailure{Message: string(OutcomeFailed), Text: nr.Error},
+			})
+			suite.Errors++
+		}
+		suite.Tests = len(suite.TestCases)
+		out.TestSuites = append(out.TestSuites, suite)
+	}
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(out); err != nil {
+		return
+	}
+	_, err = io.WriteString(w, "\n")
+	return
+}
@@ -0,0 +1,54 @@
+package ezdeploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	r := NewReport(false)
+
+	nr := r.Namespace("b")
+	nr.Add(ReportItem{ID: "b::v1/ConfigMap/demo", Kind: ReportKindResource, Outcome: OutcomeApplied, ChecksumAfter: "x"})
+	nr.Add(ReportItem{ID: "b::Helm::demo", Kind: ReportKindRelease, Outcome: OutcomeFailed, Error: "boom"})
+	nr.Finish(time.Second, errors.New("boom"))
+
+	nr = r.Namespace("a")
+	nr.Add(ReportItem{ID: "a::v1/ConfigMap/demo", Kind: ReportKindResource, Outcome: OutcomeSkipped})
+	nr.Finish(time.Second, nil)
+
+	require.Same(t, nr, r.Namespace("a"))
+
+	r.Finish(nil)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.WriteJSON(buf))
+
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	namespaces := out["namespaces"].([]any)
+	require.Len(t, namespaces, 2)
+	require.Equal(t, "a", namespaces[0].(map[string]any)["namespace"])
+
+	buf.Reset()
+	require.NoError(t, r.WriteJUnit(buf))
+	require.Contains(t, buf.String(), `<testsuite name="b" tests="2" failures="1" errors="0" skipped="0"`)
+	require.Contains(t, buf.String(), `<failure message="failed">boom</failure>`)
+	require.Contains(t, buf.String(), `<skipped message="skipped-unchanged"></skipped>`)
+
+	r.Redact(func(s string) string {
+		return strings.ReplaceAll(s, "boom", RedactedValue)
+	})
+	require.Equal(t, RedactedValue, r.Namespace("b").Error)
+	require.Equal(t, RedactedValue, r.Namespace("b").Items[1].Error)
+
+	// nil-safe
+	var nilReport *Report
+	nilReport.Namespace("a").Add(ReportItem{})
+}
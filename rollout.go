@@ -0,0 +1,278 @@
+package ezdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultRolloutInterval = time.Second * 2
+)
+
+var (
+	ErrRolloutFailed = errors.New("rollout failed")
+)
+
+// RolloutStatus status of a workload rollout
+type RolloutStatus struct {
+	Done    bool
+	Failed  bool
+	Message string
+}
+
+// IsRolloutKind returns whether the object is a workload that ezdeploy waits for
+func IsRolloutKind(object Object) bool {
+	switch object.APIVersion + "/" + object.Kind {
+	case "apps/v1/Deployment", "apps/v1/StatefulSet", "apps/v1/DaemonSet", "batch/v1/Job":
+		return true
+	}
+	return false
+}
+
+func rolloutStatusDeployment(deploy *appsv1.Deployment) (status RolloutStatus) {
+	if deploy.Generation > deploy.Status.ObservedGeneration {
+		status.Message = "waiting for deployment spec update to be observed"
+		return
+	}
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			status.Failed = true
+			status.Message = "deployment exceeded its progress deadline"
+			return
+		}
+	}
+	var replicas int32 = 1
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+	if deploy.Status.UpdatedReplicas < replicas {
+		status.Message = fmt.Sprintf("%d out of %d new replicas have been updated", deploy.Status.UpdatedReplicas, replicas)
+		return
+	}
+	if deploy.Status.Replicas > deploy.Status.UpdatedReplicas {
+		status.Message = fmt.Sprintf("%d old replicas are pending termination", deploy.Status.Replicas-deploy.Status.UpdatedReplicas)
+		return
+	}
+	if deploy.Status.AvailableReplicas < deploy.Status.UpdatedReplicas {
+		status.Message = fmt.Sprintf("%d of %d updated replicas are available", deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas)
+		return
+	}
+	status.Done = true
+	return
+}
+
+func rolloutStatusStatefulSet(sts *appsv1.StatefulSet) (status RolloutStatus) {
+	if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+		status.Message = "waiting for statefulset spec update to be observed"
+		return
+	}
+	// pods are only replaced when deleted manually, like 'kubectl rollout status' there is nothing to wait for
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		status.Done = true
+		return
+	}
+	var replicas int32 = 1
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if sts.Status.ReadyReplicas < replicas {
+		status.Message = fmt.Sprintf("%d of %d pods are ready", sts.Status.ReadyReplicas, replicas)
+		return
+	}
+	if sts.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+		sts.Spec.UpdateStrategy.RollingUpdate != nil &&
+		sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+		if sts.Status.UpdatedReplicas < replicas-*sts.Spec.UpdateStrategy.RollingUpdate.Partition {
+			status.Message = fmt.Sprintf("%d of %d partitioned pods have been updated", sts.Status.UpdatedReplicas, replicas-*sts.Spec.UpdateStrategy.RollingUpdate.Partition)
+			return
+		}
+		status.Done = true
+		return
+	}
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		status.Message = fmt.Sprintf("%d pods at revision %s", sts.Status.UpdatedReplicas, sts.Status.UpdateRevision)
+		return
+	}
+	status.Done = true
+	return
+}
+
+func rolloutStatusDaemonSet(ds *appsv1.DaemonSet) (status RolloutStatus) {
+	if ds.Generation > ds.Status.ObservedGeneration {
+		status.Message = "waiting for daemonset spec update to be observed"
+		return
+	}
+	if ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled {
+		status.Message = fmt.Sprintf("%d out of %d new pods have been updated", ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled)
+		return
+	}
+	if ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled {
+		status.Message = fmt.Sprintf("%d of %d updated pods are available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled)
+		return
+	}
+	status.Done = true
+	return
+}
+
+func rolloutStatusJob(job *batchv1.Job) (status RolloutStatus) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			status.Done = true
+			return
+		case batchv1.JobFailed:
+			status.Failed = true
+			status.Message = "job failed: " + cond.Reason + " " + cond.Message
+			return
+		}
+	}
+	status.Message = fmt.Sprintf("%d active, %d succeeded, %d failed", job.Status.Active, job.Status.Succeeded, job.Status.Failed)
+	return
+}
+
+// CheckRollout retrieve the current rollout status of a workload, and the label selector of its pods
+func CheckRollout(ctx context.Context, client kubernetes.Interface, namespace string, object Object) (status RolloutStatus, selector *metav1.LabelSelector, err error) {
+	if object.Metadata.Namespace != "" {
+		namespace = object.Metadata.Namespace
+	}
+	name := object.Metadata.Name
+
+	switch object.Kind {
+	case "Deployment":
+		var deploy *appsv1.Deployment
+		if deploy, err = client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return
+		}
+		status, selector = rolloutStatusDeployment(deploy), deploy.Spec.Selector
+	case "StatefulSet":
+		var sts *appsv1.StatefulSet
+		if sts, err = client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return
+		}
+		status, selector = rolloutStatusStatefulSet(sts), sts.Spec.Selector
+	case "DaemonSet":
+		var ds *appsv1.DaemonSet
+		if ds, err = client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return
+		}
+		status, selector = rolloutStatusDaemonSet(ds), ds.Spec.Selector
+	case "Job":
+		var job *batchv1.Job
+		if job, err = client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return
+		}
+		status, selector = rolloutStatusJob(job), job.Spec.Selector
+	default:
+		err = errors.New("unsupported rollout kind: " + object.Kind)
+	}
+	return
+}
+
+// describePodFailures collect reasons of failing pods matching the selector
+func describePodFailures(pods []corev1.Pod) (reasons []string) {
+	for _, pod := range pods {
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			var reason, message string
+			if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" && cs.State.Waiting.Reason != "ContainerCreating" && cs.State.Waiting.Reason != "PodInitializing" {
+				reason, message = cs.State.Waiting.Reason, cs.State.Waiting.Message
+			} else if cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0 {
+				reason, message = cs.State.Terminated.Reason, cs.State.Terminated.Message
+			} else {
+				continue
+			}
+			line := pod.Name + "/" + cs.Name + ": " + reason
+			if message != "" {
+				line += ": " + message
+			}
+			reasons = append(reasons, line)
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason != "" {
+				reasons = append(reasons, pod.Name+": "+cond.Reason+": "+cond.Message)
+			}
+		}
+	}
+	sort.Strings(reasons)
+	return
+}
+
+func podFailures(ctx context.Context, client kubernetes.Interface, namespace string, selector *metav1.LabelSelector) (reasons []string, err error) {
+	if selector == nil {
+		return
+	}
+	var sel string
+	if sel = metav1.FormatLabelSelector(selector); sel == "" || sel == "<none>" || sel == "<error>" {
+		return
+	}
+	var pods *corev1.PodList
+	if pods, err = client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel}); err != nil {
+		return
+	}
+	reasons = describePodFailures(pods.Items)
+	return
+}
+
+// WaitForRollout wait until the rollout of a workload completes, fails or the context is done
+func WaitForRollout(ctx context.Context, client kubernetes.Interface, namespace string, object Object, interval time.Duration) (err error) {
+	if object.Metadata.Namespace != "" {
+		namespace = object.Metadata.Namespace
+	}
+	if interval <= 0 {
+		interval = DefaultRolloutInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		status   RolloutStatus
+		selector *metav1.LabelSelector
+	)
+
+	for {
+		if status, selector, err = CheckRollout(ctx, client, namespace, object); err != nil {
+			if ctx.Err() == nil {
+				return
+			}
+		} else if status.Done {
+			return
+		} else if !status.Failed {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+				continue
+			}
+		}
+		break
+	}
+
+	// collect failure details with a fresh context, the original one may be exhausted
+	fctx, cancel := context.WithTimeout(context.Background(), interval*5)
+	defer cancel()
+
+	msg := status.Message
+	if !status.Failed {
+		msg = "timed out: " + msg
+	}
+	if reasons, _ := podFailures(fctx, client, namespace, selector); len(reasons) > 0 {
+		msg += "; " + strings.Join(reasons, "; ")
+	}
+	err = fmt.Errorf("%w: %s/%s: %s", ErrRolloutFailed, object.Kind, object.Metadata.Name, msg)
+	return
+}
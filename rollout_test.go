@@ -0,0 +1,125 @@
+package ezdeploy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIsRolloutKind(t *testing.T) {
+	require.True(t, IsRolloutKind(Object{APIVersion: "apps/v1", Kind: "Deployment"}))
+	require.True(t, IsRolloutKind(Object{APIVersion: "batch/v1", Kind: "Job"}))
+	require.False(t, IsRolloutKind(Object{APIVersion: "v1", Kind: "ConfigMap"}))
+}
+
+func TestRolloutStatusDeployment(t *testing.T) {
+	replicas := int32(2)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+	require.False(t, rolloutStatusDeployment(deploy).Done)
+
+	deploy.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}
+	require.False(t, rolloutStatusDeployment(deploy).Done)
+
+	deploy.Status.Replicas = 2
+	require.True(t, rolloutStatusDeployment(deploy).Done)
+
+	deploy.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+	}
+	require.True(t, rolloutStatusDeployment(deploy).Failed)
+}
+
+func TestRolloutStatusJob(t *testing.T) {
+	job := &batchv1.Job{}
+	require.False(t, rolloutStatusJob(job).Done)
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	require.True(t, rolloutStatusJob(job).Failed)
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	require.True(t, rolloutStatusJob(job).Done)
+}
+
+func TestWaitForRollout(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "demo"}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo-1", Namespace: "default", Labels: map[string]string{"app": "demo"}},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+				},
+			},
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	err := WaitForRollout(ctx, client, "default", Object{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   ObjectMeta{Name: "demo"},
+	}, time.Millisecond*10)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrRolloutFailed))
+	require.Contains(t, err.Error(), "demo-1/main: CrashLoopBackOff")
+}
+
+func TestWaitForRolloutStatefulSetOnDelete(t *testing.T) {
+	replicas := int32(2)
+	client := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 3},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:       &replicas,
+				Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "demo"}},
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			},
+			// old pods are kept until deleted manually
+			Status: appsv1.StatefulSetStatus{
+				ObservedGeneration: 3,
+				ReadyReplicas:      1,
+				CurrentRevision:    "demo-1",
+				UpdateRevision:     "demo-2",
+			},
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, WaitForRollout(ctx, client, "default", Object{
+		APIVersion: "apps/v1",
+		Kind:       "StatefulSet",
+		Metadata:   ObjectMeta{Name: "demo"},
+	}, time.Millisecond*10))
+
+	sts, err := client.AppsV1().StatefulSets("default").Get(ctx, "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+	sts.Generation = 4
+	require.False(t, rolloutStatusStatefulSet(sts).Done)
+
+	// rolling updates still wait for revisions to converge
+	sts.Generation = 3
+	sts.Spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+	sts.Status.ReadyReplicas = 2
+	require.False(t, rolloutStatusStatefulSet(sts).Done)
+}
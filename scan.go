@@ -1,6 +1,7 @@
 package ezdeploy
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 )
@@ -14,21 +15,55 @@ type ScanResult struct {
 	Namespaces []string
 }
 
-func Scan(root string) (result ScanResult, err error) {
+type ScanOptions struct {
+	// ChartDirs directories containing Helm charts, relative to root, defaults to [SubdirHelm]
+	ChartDirs []string
+	// Ignore rules of ignored paths
+	Ignore *Ignore
+}
+
+func Scan(root string, opts ScanOptions) (result ScanResult, err error) {
+	if len(opts.ChartDirs) == 0 {
+		opts.ChartDirs = []string{SubdirHelm}
+	}
 	// charts
-	if result.Charts, err = scanCharts(filepath.Join(root, SubdirHelm)); err != nil {
-		return
+	result.Charts = make(map[string]Chart)
+	for _, chartDir := range opts.ChartDirs {
+		if err = scanCharts(result.Charts, filepath.Join(root, chartDir), opts); err != nil {
+			return
+		}
 	}
 	// namespaces
-	if result.Namespaces, err = readDirNames(root); err != nil {
+	var names []string
+	if names, err = readDirNames(root); err != nil {
 		return
 	}
+	for _, name := range names {
+		if isChartDir(name, opts.ChartDirs) {
+			continue
+		}
+		var ignored bool
+		if ignored, err = opts.Ignore.Match(name, true); err != nil {
+			return
+		}
+		if ignored {
+			continue
+		}
+		result.Namespaces = append(result.Namespaces, name)
+	}
 	return
 }
 
-func scanCharts(dir string) (charts map[string]Chart, err error) {
-	charts = make(map[string]Chart)
+func isChartDir(name string, chartDirs []string) bool {
+	for _, chartDir := range chartDirs {
+		if filepath.Clean(chartDir) == name {
+			return true
+		}
+	}
+	return false
+}
 
+func scanCharts(charts map[string]Chart, dir string, opts ScanOptions) (err error) {
 	var names []string
 	if names, err = readDirNames(dir); err != nil {
 		if os.IsNotExist(err) {
@@ -42,13 +77,24 @@ func scanCharts(dir string) (charts map[string]Chart, err error) {
 			Name: name,
 			Path: filepath.Join(dir, name),
 		}
+		var ignored bool
+		if ignored, err = opts.Ignore.ignored(chart.Path, true); err != nil {
+			return
+		}
+		if ignored {
+			continue
+		}
+		if _, ok := charts[chart.Name]; ok {
+			err = errors.New("duplicated chart named '" + chart.Name + "'")
+			return
+		}
 		if _, err = os.Stat(filepath.Join(chart.Path, "Chart.yaml")); err != nil {
 			return
 		}
 		if _, err = os.Stat(filepath.Join(chart.Path, "values.yaml")); err != nil {
 			return
 		}
-		if chart.Checksum, err = checksumDir(chart.Path); err != nil {
+		if chart.Checksum, chart.LegacyChecksum, err = checksumDir(chart.Path, opts.Ignore); err != nil {
 			return
 		}
 		charts[chart.Name] = chart
@@ -7,7 +7,7 @@ import (
 )
 
 func TestScan(t *testing.T) {
-	res, err := Scan(filepath.Join("testdata", "root"))
+	res, err := Scan(filepath.Join("testdata", "root"), ScanOptions{})
 	require.NoError(t, err)
 	chart, ok := res.Charts["demo-chart"]
 	require.True(t, ok)
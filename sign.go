@@ -0,0 +1,223 @@
+package ezdeploy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ManifestFile manifest of checksums of all files in root, excluded from itself as a dot file
+	ManifestFile = ".ezdeploy.manifest"
+	// SignatureFile detached ed25519 signature of ManifestFile, base64 encoded
+	SignatureFile = ".ezdeploy.manifest.sig"
+
+	pemTypePrivateKey = "PRIVATE KEY"
+	pemTypePublicKey  = "PUBLIC KEY"
+
+	maxManifestDiffs = 10
+)
+
+var (
+	ErrSignatureMissing  = errors.New("signature missing")
+	ErrSignatureInvalid  = errors.New("signature invalid")
+	ErrManifestMismatch  = errors.New("files differ from signed manifest")
+	ErrInvalidSigningKey = errors.New("invalid ed25519 key")
+)
+
+// BuildManifest build manifest of root, one line of 'checksum mode path' per file, covering the same files as
+// chart checksums, sorted by path
+func BuildManifest(root string, ignore *Ignore) (buf []byte, err error) {
+	var filenames []string
+	if filenames, err = walkChecksumFiles(root, ignore); err != nil {
+		return
+	}
+
+	out := &bytes.Buffer{}
+	for _, filename := range filenames {
+		var info os.FileInfo
+		if info, err = os.Stat(filename); err != nil {
+			return
+		}
+		var rel string
+		if rel, err = filepath.Rel(root, filename); err != nil {
+			return
+		}
+		var checksum string
+		if checksum, _, err = checksumFile(filename); err != nil {
+			return
+		}
+		fmt.Fprintf(out, "%s %04o %s\n", checksum, info.Mode().Perm(), filepath.ToSlash(rel))
+	}
+	buf = out.Bytes()
+	return
+}
+
+func parseManifest(buf []byte) map[string]string {
+	out := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(buf))
+	for s.Scan() {
+		// path is the last field, thus may contain spaces
+		splits := strings.SplitN(s.Text(), " ", 3)
+		if len(splits) != 3 {
+			continue
+		}
+		out[splits[2]] = splits[0] + " " + splits[1]
+	}
+	return out
+}
+
+// diffManifest describe differences between two manifests, limited to a few paths
+func diffManifest(signed []byte, actual []byte) string {
+	a, b := parseManifest(signed), parseManifest(actual)
+
+	var diffs []string
+	for path, v := range a {
+		if w, ok := b[path]; !ok {
+			diffs = append(diffs, "removed "+path)
+		} else if v != w {
+			diffs = append(diffs, "modified "+path)
+		}
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			diffs = append(diffs, "added "+path)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i][strings.Index(diffs[i], " ")+1:] < diffs[j][strings.Index(diffs[j], " ")+1:]
+	})
+	if len(diffs) > maxManifestDiffs {
+		diffs = append(diffs[:maxManifestDiffs], fmt.Sprintf("and %d more", len(diffs)-maxManifestDiffs))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// SignRoot write manifest of root and its detached signature into root
+func SignRoot(root string, ignore *Ignore, key ed25519.PrivateKey) (err error) {
+	var manifest []byte
+	if manifest, err = BuildManifest(root, ignore); err != nil {
+		return
+	}
+	sig := ed25519.Sign(key, manifest)
+	if err = os.WriteFile(filepath.Join(root, ManifestFile), manifest, 0644); err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(root, SignatureFile), []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644)
+}
+
+// VerifyRoot verify signature of the manifest in root, and that files in root match the manifest
+func VerifyRoot(root string, ignore *Ignore, key ed25519.PublicKey) (err error) {
+	var manifest, sigRaw []byte
+	if manifest, err = os.ReadFile(filepath.Join(root, ManifestFile)); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w: %s", ErrSignatureMissing, ManifestFile)
+		}
+		return
+	}
+	if sigRaw, err = os.ReadFile(filepath.Join(root, SignatureFile)); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w: %s", ErrSignatureMissing, SignatureFile)
+		}
+		return
+	}
+
+	var sig []byte
+	if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigRaw))); err != nil {
+		err = fmt.Errorf("%w: %s", ErrSignatureInvalid, err.Error())
+		return
+	}
+	if !ed25519.Verify(key, manifest, sig) {
+		err = ErrSignatureInvalid
+		return
+	}
+
+	var actual []byte
+	if actual, err = BuildManifest(root, ignore); err != nil {
+		return
+	}
+	if !bytes.Equal(manifest, actual) {
+		err = fmt.Errorf("%w: %s", ErrManifestMismatch, diffManifest(manifest, actual))
+		return
+	}
+	return
+}
+
+// GenerateSigningKey generate an ed25519 key pair, in PEM encoded PKCS #8 and PKIX
+func GenerateSigningKey() (privPEM []byte, pubPEM []byte, err error) {
+	var (
+		pub  ed25519.PublicKey
+		priv ed25519.PrivateKey
+	)
+	if pub, priv, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		return
+	}
+	var buf []byte
+	if buf, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
+		return
+	}
+	privPEM = pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: buf})
+	if buf, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		return
+	}
+	pubPEM = pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: buf})
+	return
+}
+
+func decodePEMFile(file string, typ string) (der []byte, err error) {
+	var buf []byte
+	if buf, err = os.ReadFile(file); err != nil {
+		return
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != typ {
+		err = fmt.Errorf("%w: %s is not a PEM encoded %s", ErrInvalidSigningKey, file, strings.ToLower(typ))
+		return
+	}
+	der = block.Bytes
+	return
+}
+
+// LoadPrivateKey load a PEM encoded PKCS #8 ed25519 private key
+func LoadPrivateKey(file string) (key ed25519.PrivateKey, err error) {
+	var der []byte
+	if der, err = decodePEMFile(file, pemTypePrivateKey); err != nil {
+		return
+	}
+	var k any
+	if k, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		return
+	}
+	var ok bool
+	if key, ok = k.(ed25519.PrivateKey); !ok {
+		err = fmt.Errorf("%w: %s", ErrInvalidSigningKey, file)
+	}
+	return
+}
+
+// LoadPublicKey load a PEM encoded PKIX ed25519 public key
+func LoadPublicKey(file string) (key ed25519.PublicKey, err error) {
+	var der []byte
+	if der, err = decodePEMFile(file, pemTypePublicKey); err != nil {
+		return
+	}
+	var k any
+	if k, err = x509.ParsePKIXPublicKey(der); err != nil {
+		return
+	}
+	var ok bool
+	if key, ok = k.(ed25519.PublicKey); !ok {
+		err = fmt.Errorf("%w: %s", ErrInvalidSigningKey, file)
+	}
+	return
+}
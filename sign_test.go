@@ -0,0 +1,61 @@
+package ezdeploy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignRoot(t *testing.T) {
+	keys := t.TempDir()
+	privPEM, pubPEM, err := GenerateSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(keys, "key"), privPEM, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(keys, "key.pub"), pubPEM, 0644))
+
+	priv, err := LoadPrivateKey(filepath.Join(keys, "key"))
+	require.NoError(t, err)
+	pub, err := LoadPublicKey(filepath.Join(keys, "key.pub"))
+	require.NoError(t, err)
+	_, err = LoadPublicKey(filepath.Join(keys, "key"))
+	require.True(t, errors.Is(err, ErrInvalidSigningKey))
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "default"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "cm.yaml"), []byte("kind: ConfigMap"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "my file.yaml"), []byte("kind: Secret"), 0640))
+
+	err = VerifyRoot(root, nil, pub)
+	require.True(t, errors.Is(err, ErrSignatureMissing))
+
+	require.NoError(t, SignRoot(root, nil, priv))
+	require.NoError(t, VerifyRoot(root, nil, pub))
+
+	manifest, err := os.ReadFile(filepath.Join(root, ManifestFile))
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), " 0640 default/my file.yaml\n")
+
+	// modified and added files
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "cm.yaml"), []byte("kind: Namespace"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "default", "new.yaml"), []byte("kind: Pod"), 0640))
+	err = VerifyRoot(root, nil, pub)
+	require.True(t, errors.Is(err, ErrManifestMismatch))
+	require.Contains(t, err.Error(), "modified default/cm.yaml, added default/new.yaml")
+
+	// tampered manifest
+	require.NoError(t, SignRoot(root, nil, priv))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ManifestFile), append(manifest, '\n'), 0644))
+	require.True(t, errors.Is(VerifyRoot(root, nil, pub), ErrSignatureInvalid))
+
+	// another key
+	_, otherPEM, err := GenerateSigningKey()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(keys, "other.pub"), otherPEM, 0644))
+	other, err := LoadPublicKey(filepath.Join(keys, "other.pub"))
+	require.NoError(t, err)
+	require.NoError(t, SignRoot(root, nil, priv))
+	require.True(t, errors.Is(VerifyRoot(root, nil, other), ErrSignatureInvalid))
+}
@@ -0,0 +1,152 @@
+package ezdeploy
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	StatusConfigMapName = "ezdeploy-status"
+
+	StatusKeyRunID       = "runId"
+	StatusKeyStartedAt   = "startedAt"
+	StatusKeyFinishedAt  = "finishedAt"
+	StatusKeyGitCommit   = "gitCommit"
+	StatusKeyVersion     = "version"
+	StatusKeyApplied     = "applied"
+	StatusKeySkipped     = "skipped"
+	StatusKeyFailed      = "failed"
+	StatusKeyError       = "error"
+	StatusKeyLastError   = "lastError"
+	StatusKeyLastErrorAt = "lastErrorAt"
+
+	EventReasonApplied = "EzdeployApplied"
+	EventReasonFailed  = "EzdeployFailed"
+	EventSource        = "ezdeploy"
+
+	LabelKeyManagedBy = "app.kubernetes.io/managed-by"
+	LabelValManagedBy = "ezdeploy"
+)
+
+// statusData build data of status ConfigMap, lastError is carried over from previous data
+func statusData(report *Report, nr *NamespaceReport, previous map[string]string) map[string]string {
+	counts := nr.Counts()
+	data := map[string]string{
+		StatusKeyRunID:      report.RunID,
+		StatusKeyStartedAt:  report.StartedAt.UTC().Format(time.RFC3339),
+		StatusKeyFinishedAt: report.FinishedAt.UTC().Format(time.RFC3339),
+		StatusKeyGitCommit:  report.GitCommit,
+		StatusKeyVersion:    report.Version,
+		StatusKeyApplied:    strconv.Itoa(counts[OutcomeApplied]),
+		StatusKeySkipped:    strconv.Itoa(counts[OutcomeSkipped]),
+		StatusKeyFailed:     strconv.Itoa(counts[OutcomeFailed]),
+		StatusKeyError:      nr.Error,
+	}
+	if nr.Error != "" {
+		data[StatusKeyLastError] = nr.Error
+		data[StatusKeyLastErrorAt] = data[StatusKeyFinishedAt]
+	} else {
+		data[StatusKeyLastError] = previous[StatusKeyLastError]
+		data[StatusKeyLastErrorAt] = previous[StatusKeyLastErrorAt]
+	}
+	return data
+}
+
+// PublishStatus create or update the status ConfigMap in namespace of nr
+func PublishStatus(ctx context.Context, client kubernetes.Interface, report *Report, nr *NamespaceReport) (err error) {
+	api := client.CoreV1().ConfigMaps(nr.Namespace)
+
+	var cm *corev1.ConfigMap
+	if cm, err = api.Get(ctx, StatusConfigMapName, metav1.GetOptions{}); err != nil {
+		if !k8s_errors.IsNotFound(err) {
+			return
+		}
+		_, err = api.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   StatusConfigMapName,
+				Labels: map[string]string{LabelKeyManagedBy: LabelValManagedBy},
+			},
+			Data: statusData(report, nr, nil),
+		}, metav1.CreateOptions{})
+		return
+	}
+
+	cm.Data = statusData(report, nr, cm.Data)
+	_, err = api.Update(ctx, cm, metav1.UpdateOptions{})
+	return
+}
+
+func eventName(obj *Object) string {
+	name := strings.ToLower(obj.Kind + "." + obj.Metadata.Name)
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return name + "." + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// PublishEvents create an Event for every applied or failed resource of nr, cluster scoped objects are
+// reported in namespace of nr
+func PublishEvents(ctx context.Context, client kubernetes.Interface, report *Report, nr *NamespaceReport) (err error) {
+	var errs []error
+
+	for _, item := range nr.Items {
+		if item.Kind != ReportKindResource || item.Object == nil {
+			continue
+		}
+
+		event := &corev1.Event{
+			InvolvedObject: corev1.ObjectReference{
+				APIVersion: item.Object.APIVersion,
+				Kind:       item.Object.Kind,
+				Name:       item.Object.Metadata.Name,
+				Namespace:  item.Object.Metadata.Namespace,
+			},
+			Source:         corev1.EventSource{Component: EventSource},
+			FirstTimestamp: metav1.NewTime(report.FinishedAt),
+			LastTimestamp:  metav1.NewTime(report.FinishedAt),
+			Count:          1,
+		}
+
+		message := "run " + report.RunID + ", ezdeploy " + report.Version
+		if report.GitCommit != "" {
+			message += ", commit " + report.GitCommit
+		}
+
+		switch item.Outcome {
+		case OutcomeApplied:
+			event.Type = corev1.EventTypeNormal
+			event.Reason = EventReasonApplied
+			event.Message = "applied by " + message
+		case OutcomeFailed:
+			event.Type = corev1.EventTypeWarning
+			event.Reason = EventReasonFailed
+			event.Message = "failed in " + message + ": " + item.Error
+		default:
+			continue
+		}
+
+		namespace := item.Object.Metadata.Namespace
+		if namespace == "" {
+			namespace = nr.Namespace
+		}
+		event.ObjectMeta = metav1.ObjectMeta{
+			Name:      eventName(item.Object),
+			Namespace: namespace,
+		}
+
+		if _, err := client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	err = errors.Join(errs...)
+	return
+}
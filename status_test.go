@@ -0,0 +1,82 @@
+package ezdeploy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPublishStatus(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	report := NewReport(false)
+	report.GitCommit = "abcdef"
+	nr := report.Namespace("default")
+	nr.Add(ReportItem{
+		ID:      "default::apps/v1/Deployment/demo",
+		Kind:    ReportKindResource,
+		Object:  &Object{APIVersion: "apps/v1", Kind: "Deployment", Metadata: ObjectMeta{Name: "demo", Namespace: "default"}},
+		Outcome: OutcomeApplied,
+	})
+	nr.Add(ReportItem{ID: "default::Helm::demo", Kind: ReportKindRelease, Outcome: OutcomeSkipped})
+	nr.Finish(time.Second, errors.New("boom"))
+	report.Finish(nil)
+
+	require.NoError(t, PublishStatus(ctx, client, report, nr))
+
+	cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, StatusConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, report.RunID, cm.Data[StatusKeyRunID])
+	require.Equal(t, "abcdef", cm.Data[StatusKeyGitCommit])
+	require.Equal(t, "1", cm.Data[StatusKeyApplied])
+	require.Equal(t, "1", cm.Data[StatusKeySkipped])
+	require.Equal(t, "boom", cm.Data[StatusKeyLastError])
+
+	// last error is kept by a successful run
+	report = NewReport(false)
+	nr = report.Namespace("default")
+	nr.Finish(time.Second, nil)
+	report.Finish(nil)
+
+	require.NoError(t, PublishStatus(ctx, client, report, nr))
+
+	cm, err = client.CoreV1().ConfigMaps("default").Get(ctx, StatusConfigMapName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, report.RunID, cm.Data[StatusKeyRunID])
+	require.Equal(t, "", cm.Data[StatusKeyError])
+	require.Equal(t, "boom", cm.Data[StatusKeyLastError])
+}
+
+func TestPublishEvents(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	report := NewReport(false)
+	nr := report.Namespace("default")
+	nr.Add(ReportItem{
+		Kind:    ReportKindResource,
+		Object:  &Object{APIVersion: "v1", Kind: "ConfigMap", Metadata: ObjectMeta{Name: "demo", Namespace: "default"}},
+		Outcome: OutcomeApplied,
+	})
+	nr.Add(ReportItem{
+		Kind:    ReportKindResource,
+		Object:  &Object{APIVersion: "v1", Kind: "ConfigMap", Metadata: ObjectMeta{Name: "skipped", Namespace: "default"}},
+		Outcome: OutcomeSkipped,
+	})
+	report.Finish(nil)
+
+	require.NoError(t, PublishEvents(ctx, client, report, nr))
+
+	events, err := client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	require.Equal(t, EventReasonApplied, events.Items[0].Reason)
+	require.Equal(t, "demo", events.Items[0].InvolvedObject.Name)
+	require.Contains(t, events.Items[0].Message, report.RunID)
+}
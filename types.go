@@ -8,6 +8,8 @@ type Chart struct {
 	Name     string
 	Path     string
 	Checksum string
+	// LegacyChecksum checksum in legacy MD5 format, for migrating state
+	LegacyChecksum string
 }
 
 type Release struct {
@@ -15,7 +17,10 @@ type Release struct {
 	Name       string
 	Chart      Chart
 	ValuesFile string
+	ValuesType string
 	Checksum   string
+	// LegacyChecksum checksum in legacy MD5 format, for migrating state
+	LegacyChecksum string
 }
 
 func CreateReleaseID(namespace string, name string) string {
@@ -51,6 +56,8 @@ type Resource struct {
 	Raw       json.RawMessage
 	Checksum  string
 	Path      string
+	// LegacyChecksum checksum in legacy MD5 format, for migrating state
+	LegacyChecksum string
 }
 
 type ObjectMeta struct {
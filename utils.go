@@ -48,9 +48,17 @@ func streamFile(w io.Writer, filename string) (err error) {
 	return
 }
 
-func ConvertJSONNetFileToYAML(file string, namespace string) (outFile string, err error) {
+func newJSONNetVM(namespace string, extVars map[string]string) *jsonnet.VM {
 	vm := jsonnet.MakeVM()
+	for k, v := range extVars {
+		vm.ExtVar(k, v)
+	}
 	vm.ExtVar("NAMESPACE", namespace)
+	return vm
+}
+
+func ConvertJSONNetFileToYAML(file string, namespace string, extVars map[string]string) (outFile string, err error) {
+	vm := newJSONNetVM(namespace, extVars)
 	var raw string
 	if raw, err = vm.EvaluateFile(file); err != nil {
 		return
@@ -0,0 +1,43 @@
+package ezdeploy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Version ezdeploy version, can be set with '-ldflags "-X github.com/yankeguo/ezdeploy.Version=..."'
+var Version = ""
+
+// BuildVersion returns Version, or the module version from build info
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+var gitCommitEnvs = []string{"GIT_COMMIT", "GITHUB_SHA", "CI_COMMIT_SHA", "BUILD_SOURCEVERSION"}
+
+// ResolveGitCommit returns git commit of the resource root from well-known environment variables or git,
+// empty string if not available
+func ResolveGitCommit(root string) string {
+	for _, key := range gitCommitEnvs {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	buf, err := exec.CommandContext(ctx, "git", "-C", root, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
@@ -0,0 +1,28 @@
+package ezdeploy
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildVersion(t *testing.T) {
+	require.NotEmpty(t, BuildVersion())
+	Version = "v1.2.3"
+	defer func() {
+		Version = ""
+	}()
+	require.Equal(t, "v1.2.3", BuildVersion())
+}
+
+func TestResolveGitCommit(t *testing.T) {
+	t.Setenv("GIT_COMMIT", "abcdef")
+	require.Equal(t, "abcdef", ResolveGitCommit("."))
+
+	t.Setenv("GIT_COMMIT", "")
+	for _, key := range gitCommitEnvs {
+		t.Setenv(key, "")
+	}
+	require.Empty(t, ResolveGitCommit(os.TempDir()))
+}
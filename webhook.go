@@ -0,0 +1,294 @@
+package ezdeploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	WebhookFormatJSON    = "json"
+	WebhookFormatSlack   = "slack"
+	WebhookFormatDiscord = "discord"
+
+	WebhookOnAlways  = "always"
+	WebhookOnFailure = "failure"
+	WebhookOnChange  = "change"
+
+	DefaultWebhookRetries = 3
+)
+
+var (
+	webhookBackoff    = time.Second
+	webhookBackoffMax = time.Second * 30
+)
+
+// SummaryFailure a failed item or namespace in Summary
+type SummaryFailure struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id,omitempty"`
+	Error     string `json:"error"`
+}
+
+// Summary summary of a run, sent to webhooks
+type Summary struct {
+	RunID            string           `json:"runId"`
+	Version          string           `json:"version"`
+	GitCommit        string           `json:"gitCommit,omitempty"`
+	DryRun           bool             `json:"dryRun"`
+	Success          bool             `json:"success"`
+	Duration         float64          `json:"durationSeconds"`
+	Namespaces       []string         `json:"namespaces"`
+	ResourcesChanged int              `json:"resourcesChanged"`
+	ReleasesUpgraded int              `json:"releasesUpgraded"`
+	HooksExecuted    int              `json:"hooksExecuted"`
+	Failures         []SummaryFailure `json:"failures"`
+	Error            string           `json:"error,omitempty"`
+}
+
+// Changed returns whether anything was applied or failed
+func (s Summary) Changed() bool {
+	return s.ResourcesChanged+s.ReleasesUpgraded+s.HooksExecuted > 0 || len(s.Failures) > 0
+}
+
+// NewSummary summarize a finished Report, namespaces touched are those with applied or failed items
+func NewSummary(report *Report) (s Summary) {
+	report.lock.Lock()
+	defer report.lock.Unlock()
+
+	s = Summary{
+		RunID:      report.RunID,
+		Version:    report.Version,
+		GitCommit:  report.GitCommit,
+		DryRun:     report.DryRun,
+		Success:    report.Error == "",
+		Duration:   report.FinishedAt.Sub(report.StartedAt).Seconds(),
+		Namespaces: []string{},
+		Failures:   []SummaryFailure{},
+		Error:      report.Error,
+	}
+
+	for _, nr := range report.Namespaces {
+		touched := nr.Error != ""
+		itemFailed := false
+		for _, item := range nr.Items {
+			switch item.Outcome {
+			case OutcomeApplied:
+				touched = true
+				switch item.Kind {
+				case ReportKindRelease:
+					s.ReleasesUpgraded++
+				case ReportKindHook:
+					s.HooksExecuted++
+				default:
+					s.ResourcesChanged++
+				}
+			case OutcomeFailed:
+				touched, itemFailed = true, true
+				s.Failures = append(s.Failures, SummaryFailure{Namespace: nr.Namespace, ID: item.ID, Error: item.Error})
+			}
+		}
+		if nr.Error != "" && !itemFailed {
+			s.Failures = append(s.Failures, SummaryFailure{Namespace: nr.Namespace, Error: nr.Error})
+		}
+		if touched {
+			s.Namespaces = append(s.Namespaces, nr.Namespace)
+		}
+	}
+	return
+}
+
+// WebhookConfig an outbound webhook, '${VAR}' in url and headers are expanded from environment variables
+type WebhookConfig struct {
+	// URL endpoint receiving a POST request
+	URL string `yaml:"url"`
+	// Format builtin payload format, one of json (default), slack and discord
+	Format string `yaml:"format"`
+	// Template custom Go template of payload, executed with Summary, overrides Format
+	Template string `yaml:"template"`
+	// On when to fire, one of always (default), failure and change
+	On string `yaml:"on"`
+	// Headers additional request headers
+	Headers map[string]string `yaml:"headers"`
+	// Retries number of retries on network errors, 429 and 5xx responses
+	Retries *int `yaml:"retries"`
+}
+
+// Validate check all fields
+func (w WebhookConfig) Validate() (err error) {
+	if w.URL == "" {
+		return errors.New("'url' must not be empty")
+	}
+	switch w.Format {
+	case "", WebhookFormatJSON, WebhookFormatSlack, WebhookFormatDiscord:
+	default:
+		return errors.New("invalid 'format': '" + w.Format + "'")
+	}
+	switch w.On {
+	case "", WebhookOnAlways, WebhookOnFailure, WebhookOnChange:
+	default:
+		return errors.New("invalid 'on': '" + w.On + "'")
+	}
+	if w.Retries != nil && *w.Retries < 0 {
+		return errors.New("'retries' must not be negative")
+	}
+	if w.Template != "" {
+		if _, err = newWebhookTemplate(w.Template); err != nil {
+			return errors.New("invalid 'template': " + err.Error())
+		}
+	}
+	return
+}
+
+// ShouldFire returns whether the webhook fires for the summary
+func (w WebhookConfig) ShouldFire(s Summary) bool {
+	switch w.On {
+	case WebhookOnFailure:
+		return !s.Success || len(s.Failures) > 0
+	case WebhookOnChange:
+		return s.Changed()
+	default:
+		return true
+	}
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+	"join": strings.Join,
+}
+
+func newWebhookTemplate(s string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookTemplateFuncs).Parse(s)
+}
+
+const summaryTextTemplate = `{{if .Success}}ezdeploy succeeded{{else}}ezdeploy FAILED{{end}}{{if .DryRun}} (dry run){{end}}` +
+	` in {{printf "%.1f" .Duration}}s, run {{.RunID}}{{if .GitCommit}}, commit {{.GitCommit}}{{end}}
+namespaces: {{if .Namespaces}}{{join .Namespaces ", "}}{{else}}none{{end}}
+resources changed: {{.ResourcesChanged}}, releases upgraded: {{.ReleasesUpgraded}}, hooks executed: {{.HooksExecuted}}
+{{- range .Failures}}
+- {{.Namespace}}{{if .ID}} {{.ID}}{{end}}: {{.Error}}
+{{- end}}`
+
+var summaryText = template.Must(newWebhookTemplate(summaryTextTemplate))
+
+// RenderSummaryText render a human-readable message of the summary
+func RenderSummaryText(s Summary) (string, error) {
+	sb := &strings.Builder{}
+	if err := summaryText.Execute(sb, s); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// Payload render request body for the summary
+func (w WebhookConfig) Payload(s Summary) (buf []byte, err error) {
+	if w.Template != "" {
+		var tpl *template.Template
+		if tpl, err = newWebhookTemplate(w.Template); err != nil {
+			return
+		}
+		out := &bytes.Buffer{}
+		if err = tpl.Execute(out, s); err != nil {
+			return
+		}
+		buf = out.Bytes()
+		return
+	}
+
+	if w.Format == "" || w.Format == WebhookFormatJSON {
+		return json.Marshal(s)
+	}
+
+	var text string
+	if text, err = RenderSummaryText(s); err != nil {
+		return
+	}
+	switch w.Format {
+	case WebhookFormatSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case WebhookFormatDiscord:
+		// discord limits content to 2000 characters
+		return json.Marshal(map[string]string{"content": truncateText(text, 2000)})
+	}
+	err = errors.New("invalid webhook format: '" + w.Format + "'")
+	return
+}
+
+// truncateText truncate text to at most limit characters, ending with '...' if truncated
+func truncateText(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit-3]) + "..."
+}
+
+func sendWebhookOnce(ctx context.Context, w WebhookConfig, body []byte) (retry bool, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(w.URL), bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ezdeploy/"+BuildVersion())
+	for k, v := range w.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	var res *http.Response
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		retry = ctx.Err() == nil
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err = errors.New("webhook responded with status " + strconv.Itoa(res.StatusCode) + ": " + strings.TrimSpace(string(msg)))
+	retry = res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return
+}
+
+// SendWebhook send the summary to the webhook, retrying with exponential backoff
+func SendWebhook(ctx context.Context, w WebhookConfig, s Summary) (err error) {
+	var body []byte
+	if body, err = w.Payload(s); err != nil {
+		return
+	}
+
+	retries := DefaultWebhookRetries
+	if w.Retries != nil {
+		retries = *w.Retries
+	}
+
+	backoff := webhookBackoff
+
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = sendWebhookOnce(ctx, w, body); err == nil || !retry || attempt >= retries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > webhookBackoffMax {
+			backoff = webhookBackoffMax
+		}
+	}
+}
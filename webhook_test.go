@@ -0,0 +1,123 @@
+package ezdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testSummaryReport() *Report {
+	report := NewReport(false)
+	nr := report.Namespace("a")
+	nr.Add(ReportItem{ID: "a::v1/ConfigMap/demo", Kind: ReportKindResource, Outcome: OutcomeApplied})
+	nr.Add(ReportItem{ID: "a::Helm::demo", Kind: ReportKindRelease, Outcome: OutcomeApplied})
+	nr.Finish(time.Second, nil)
+	nr = report.Namespace("b")
+	nr.Add(ReportItem{ID: "b::v1/ConfigMap/demo", Kind: ReportKindResource, Outcome: OutcomeSkipped})
+	nr.Finish(time.Second, nil)
+	nr = report.Namespace("c")
+	nr.Finish(time.Second, errors.New("missing chart"))
+	report.Finish(errors.New("missing chart"))
+	return report
+}
+
+func TestNewSummary(t *testing.T) {
+	s := NewSummary(testSummaryReport())
+	require.False(t, s.Success)
+	require.Equal(t, []string{"a", "c"}, s.Namespaces)
+	require.Equal(t, 1, s.ResourcesChanged)
+	require.Equal(t, 1, s.ReleasesUpgraded)
+	require.Equal(t, []SummaryFailure{{Namespace: "c", Error: "missing chart"}}, s.Failures)
+	require.True(t, s.Changed())
+
+	text, err := RenderSummaryText(s)
+	require.NoError(t, err)
+	require.Contains(t, text, "ezdeploy FAILED")
+	require.Contains(t, text, "- c: missing chart")
+}
+
+func TestWebhookConfig(t *testing.T) {
+	require.Error(t, WebhookConfig{}.Validate())
+	require.Error(t, WebhookConfig{URL: "http://a", Format: "xml"}.Validate())
+	require.Error(t, WebhookConfig{URL: "http://a", On: "never"}.Validate())
+	require.Error(t, WebhookConfig{URL: "http://a", Template: "{{"}.Validate())
+	require.NoError(t, WebhookConfig{URL: "http://a", Format: WebhookFormatSlack, On: WebhookOnFailure}.Validate())
+
+	s := Summary{Success: true}
+	require.True(t, WebhookConfig{}.ShouldFire(s))
+	require.False(t, WebhookConfig{On: WebhookOnFailure}.ShouldFire(s))
+	require.False(t, WebhookConfig{On: WebhookOnChange}.ShouldFire(s))
+	s.ResourcesChanged = 1
+	require.True(t, WebhookConfig{On: WebhookOnChange}.ShouldFire(s))
+
+	buf, err := WebhookConfig{Format: WebhookFormatSlack}.Payload(s)
+	require.NoError(t, err)
+	var m map[string]string
+	require.NoError(t, json.Unmarshal(buf, &m))
+	require.Contains(t, m["text"], "ezdeploy succeeded")
+
+	buf, err = WebhookConfig{Template: `{"ok":{{json .Success}}}`}.Payload(s)
+	require.NoError(t, err)
+	require.Equal(t, `{"ok":true}`, string(buf))
+}
+
+func TestTruncateText(t *testing.T) {
+	require.Equal(t, "hello", truncateText("hello", 5))
+	require.Equal(t, "he...", truncateText("hello!", 5))
+
+	out := truncateText(strings.Repeat("部署", 1500), 2000)
+	require.True(t, utf8.ValidString(out))
+	require.Equal(t, 2000, utf8.RuneCountInString(out))
+	require.True(t, strings.HasSuffix(out, "部..."))
+}
+
+func TestSendWebhook(t *testing.T) {
+	webhookBackoff = time.Millisecond
+	defer func() {
+		webhookBackoff = time.Second
+	}()
+
+	var (
+		calls int32
+		body  []byte
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		require.Equal(t, "token", req.Header.Get("Authorization"))
+		body, _ = io.ReadAll(req.Body)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	t.Setenv("EZDEPLOY_TEST_TOKEN", "token")
+
+	err := SendWebhook(context.Background(), WebhookConfig{
+		URL:     s.URL,
+		Headers: map[string]string{"Authorization": "${EZDEPLOY_TEST_TOKEN}"},
+	}, NewSummary(testSummaryReport()))
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls)
+
+	var out Summary
+	require.NoError(t, json.Unmarshal(body, &out))
+	require.Equal(t, 1, out.ResourcesChanged)
+
+	retries := 0
+	atomic.StoreInt32(&calls, 0)
+	err = SendWebhook(context.Background(), WebhookConfig{URL: s.URL, Retries: &retries}, Summary{})
+	require.Error(t, err)
+	require.Equal(t, int32(1), calls)
+}